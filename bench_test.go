@@ -51,6 +51,55 @@ func BenchmarkDecoder(b *testing.B) {
 	b.SetBytes(int64(len(benchmarkData)))
 }
 
+func BenchmarkDecoderNext(b *testing.B) {
+	if benchmarkData == nil {
+		b.StopTimer()
+		initBenchmarkData()
+		b.StartTimer()
+	}
+	b.ReportAllocs()
+	var buf bytes.Buffer
+	dec := NewDecoder(&buf)
+	for i := 0; i < b.N; i++ {
+		buf.Write(benchmarkData)
+
+		var err error
+		for err != io.EOF {
+			_, err = dec.Next()
+
+			if err != nil && err != io.EOF {
+				b.Fatal("Next:", err)
+			}
+		}
+	}
+	b.SetBytes(int64(len(benchmarkData)))
+}
+
+func BenchmarkDecoderDecodeInto(b *testing.B) {
+	if benchmarkData == nil {
+		b.StopTimer()
+		initBenchmarkData()
+		b.StartTimer()
+	}
+	b.ReportAllocs()
+	var buf bytes.Buffer
+	var event Event
+	dec := NewDecoder(&buf)
+	for i := 0; i < b.N; i++ {
+		buf.Write(benchmarkData)
+
+		var err error
+		for err != io.EOF {
+			err = dec.DecodeInto(&event)
+
+			if err != nil && err != io.EOF {
+				b.Fatal("DecodeInto:", err)
+			}
+		}
+	}
+	b.SetBytes(int64(len(benchmarkData)))
+}
+
 func BenchmarkEncoder(b *testing.B) {
 	if benchmarkData == nil {
 		b.StopTimer()
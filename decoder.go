@@ -3,6 +3,8 @@ package eventsource
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"unicode/utf8"
 )
@@ -11,16 +13,93 @@ import (
 type Decoder struct {
 	r *bufio.Reader
 
+	maxLine, maxEvent int
+
 	checkedBOM bool
+
+	// pos is the position of the next unread byte, and start that of the
+	// last line read
+	pos, start Position
+
+	keepExtra, strict bool
+
+	// skipLF is set after a line ending in CR, so that an LF arriving next
+	// completes a CRLF pair instead of ending an empty line.
+	skipLF bool
+
+	// buffers reused from one line or event to the next
+	line, typ, id, retry, data []byte
+	extra                      []Field
+
+	// the event being streamed by NextEvent, if any
+	cur *EventReader
 }
 
+// A RawEvent is an event as returned by Decoder.Next. Its fields refer to the
+// decoder's internal buffers, and are only valid until the next call to the
+// decoder.
+type RawEvent struct {
+	Type    []byte
+	ID      []byte
+	Retry   []byte
+	Data    []byte
+	ResetID bool
+	Extra   []Field
+}
+
+// messageType is the type of events without an event field. It is shared by
+// every RawEvent, and must not be modified.
+var messageType = []byte("message")
+
 // NewDecoder returns a new decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: bufio.NewReader(r)}
+	return NewDecoderSize(r, 0, 0)
+}
+
+// NewDecoderSize returns a new decoder that reads from r, and rejects lines
+// longer than maxLine bytes and events longer than maxEvent bytes with
+// ErrEventTooLarge. A limit which is not positive is ignored.
+func NewDecoderSize(r io.Reader, maxLine, maxEvent int) *Decoder {
+	return &Decoder{
+		r:        bufio.NewReader(r),
+		maxLine:  maxLine,
+		maxEvent: maxEvent,
+		pos:      Position{Line: 1},
+	}
+}
+
+// KeepExtraFields makes the decoder record comments and unrecognised fields
+// in each event's Extra field, instead of discarding them.
+func (d *Decoder) KeepExtraFields() {
+	d.keepExtra = true
+}
+
+// Strict makes the decoder reject events with an id containing NUL or a
+// retry value which is not an integer, returning a *DecodeError wrapping
+// ErrInvalidID or ErrInvalidRetry. Otherwise, as the spec requires, such
+// fields are ignored.
+func (d *Decoder) Strict() {
+	d.strict = true
+}
+
+// A Position identifies a location in the decoder's input.
+type Position struct {
+	Line   int   // line number, starting at 1
+	Offset int64 // byte offset, starting at 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, offset %d", p.Line, p.Offset)
+}
+
+// Position returns the position of the next byte the decoder will read. After
+// a line ending in CR, this may be an LF completing the line terminator.
+func (d *Decoder) Position() Position {
+	return d.pos
 }
 
 func (d *Decoder) checkBOM() {
-	r, _, err := d.r.ReadRune()
+	r, size, err := d.r.ReadRune()
 
 	if err != nil {
 		// let other other callers handle this
@@ -29,45 +108,224 @@ func (d *Decoder) checkBOM() {
 
 	if r != 0xFEFF { // utf8 byte order mark
 		d.r.UnreadRune()
+	} else {
+		d.pos.Offset += int64(size)
 	}
 
 	d.checkedBOM = true
 }
 
-// ReadField reads a single line from the stream and parses it as a field. A
-// complete event is signalled by an empty key and value. The returned error
-// may either be an error from the stream, or an ErrInvalidEncoding if the
-// value is not valid UTF-8.
-func (d *Decoder) ReadField() (field string, value []byte, err error) {
-	if !d.checkedBOM {
-		d.checkBOM()
+// completeCRLF consumes the LF of a CRLF pair, if the previous line ended in
+// CR.
+func (d *Decoder) completeCRLF() error {
+	if !d.skipLF {
+		return nil
+	}
+
+	d.skipLF = false
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if b != '\n' {
+		d.r.UnreadByte()
+	} else {
+		d.pos.Offset++
+	}
+
+	return nil
+}
+
+// scan returns the next piece of the current line from the buffer, up to the
+// first of delims or max bytes, if max is positive. The delimiter found is
+// consumed and returned, or zero if there was none. Lines may end in CR, LF
+// or CRLF. The chunk is only valid until the next read.
+func (d *Decoder) scan(delims string, max int) (chunk []byte, delim byte, err error) {
+	if err := d.completeCRLF(); err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, 0, err
+	}
+
+	buf, _ := d.r.Peek(d.r.Buffered())
+
+	if max > 0 && len(buf) > max {
+		buf = buf[:max]
+	}
+
+	if i := bytes.IndexAny(buf, delims); i >= 0 {
+		d.skipLF = buf[i] == '\r'
+		d.r.Discard(i + 1)
+		d.pos.Offset += int64(i + 1)
+
+		if buf[i] == '\r' || buf[i] == '\n' {
+			d.pos.Line++
+		}
+
+		return buf[:i], buf[i], nil
+	}
+
+	d.r.Discard(len(buf))
+	d.pos.Offset += int64(len(buf))
+	return buf, 0, nil
+}
+
+// readChunk returns the next piece of the current line, no longer than max
+// bytes if max is positive, and whether it completes the line.
+func (d *Decoder) readChunk(max int) (chunk []byte, eol bool, err error) {
+	chunk, delim, err := d.scan("\r\n", max)
+	return chunk, delim != 0, err
+}
+
+// lineLimit returns the longest line which may be read once size bytes of
+// the current event have been: the decoder's line limit or, without one, what
+// remains of its event limit, so that no line is buffered beyond either.
+func (d *Decoder) lineLimit(size int) int {
+	if d.maxLine > 0 || d.maxEvent <= 0 {
+		return d.maxLine
 	}
 
-	var buf []byte
+	return max(d.maxEvent-size, 1)
+}
+
+// readLine reads a complete line into the decoder's line buffer, which is
+// only valid until the next read. A final line without a terminator is
+// returned as is. A line longer than max bytes, if max is positive, is
+// discarded, and ErrEventTooLarge returned.
+func (d *Decoder) readLine(max int) ([]byte, error) {
+	line := d.line[:0]
+	var tooLarge bool
 
 	for {
-		line, isPrefix, err := d.r.ReadLine()
+		chunk, eol, err := d.readChunk(0)
+
+		if err == io.EOF && (len(line) > 0 || tooLarge) {
+			err = nil
+			eol = true
+		}
 
 		if err != nil {
-			return "", nil, err
+			return nil, err
 		}
 
-		buf = append(buf, line...)
+		if max > 0 && len(line)+len(chunk) > max {
+			tooLarge, line = true, line[:0]
+		}
 
-		if !isPrefix {
-			break
+		if !tooLarge {
+			line = append(line, chunk...)
+		}
+
+		if !eol {
+			continue
+		}
+
+		d.line = line
+
+		if tooLarge {
+			return nil, ErrEventTooLarge
+		}
+
+		return line, nil
+	}
+}
+
+// readName reads the field name at the start of a line into the line buffer.
+// colon reports whether the name was followed by a colon, in which case the
+// value remains to be read; otherwise the line has been consumed. A name
+// longer than max bytes, if max is positive, is reported with
+// ErrEventTooLarge.
+func (d *Decoder) readName(max int) (name []byte, colon bool, err error) {
+	name = d.line[:0]
+
+	for {
+		chunk, delim, err := d.scan(":\r\n", 0)
+
+		if err == io.EOF && len(name) > 0 {
+			err, delim = nil, '\n'
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if max > 0 && len(name)+len(chunk) > max {
+			// discard the rest of the line, as readLine does
+			if delim != '\r' && delim != '\n' {
+				if err := d.skipLine(); err != nil && err != io.EOF {
+					return nil, false, err
+				}
+			}
+
+			return nil, false, ErrEventTooLarge
+		}
+
+		name = append(name, chunk...)
+
+		if delim != 0 {
+			d.line = name
+			return name, delim == ':', nil
+		}
+	}
+}
+
+// skipLine discards the rest of the current line.
+func (d *Decoder) skipLine() error {
+	for {
+		_, eol, err := d.readChunk(0)
+
+		if err != nil || eol {
+			return err
+		}
+	}
+}
+
+// skipEvent discards the rest of the current event, through the blank line
+// ending it. It must be called at the start of a line.
+func (d *Decoder) skipEvent() error {
+	start := true
+
+	for {
+		chunk, eol, err := d.readChunk(0)
+
+		if err != nil {
+			return err
+		}
+
+		if start && eol && len(chunk) == 0 {
+			return nil
 		}
+
+		start = eol
 	}
+}
 
-	if len(buf) == 0 {
-		return "", nil, nil
+// readField reads and parses a line of at most max bytes without copying it.
+// A blank line is reported with a nil field; a comment has an empty, non-nil
+// field.
+func (d *Decoder) readField(max int) (field, value []byte, err error) {
+	if !d.checkedBOM {
+		d.checkBOM()
+	}
+
+	if err := d.completeCRLF(); err != nil {
+		return nil, nil, err
 	}
 
-	parts := bytes.SplitN(buf, []byte{':'}, 2)
-	field = string(parts[0])
+	d.start = d.pos
+	line, err := d.readLine(max)
 
-	if len(parts) == 2 {
-		value = parts[1]
+	if err != nil || len(line) == 0 {
+		return nil, nil, err
+	}
+
+	field = line
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		field, value = line[:i], line[i+1:]
 	}
 
 	// §7. If value starts with a U+0020 SPACE character, remove it from value.
@@ -75,51 +333,217 @@ func (d *Decoder) ReadField() (field string, value []byte, err error) {
 		value = value[1:]
 	}
 
-	if !utf8.ValidString(field) || !utf8.Valid(value) {
-		err = ErrInvalidEncoding
+	if !utf8.Valid(field) || !utf8.Valid(value) {
+		err = d.decodeError(string(field), line, ErrInvalidEncoding)
 	}
 
 	return
 }
 
-// Decode reads the next event from its input and stores it in the provided
-// Event pointer.
-func (d *Decoder) Decode(e *Event) error {
-	var wroteData bool
+// decodeError reports err for the last line read.
+func (d *Decoder) decodeError(field string, raw []byte, err error) *DecodeError {
+	return &DecodeError{
+		Pos:   d.start,
+		Field: field,
+		Raw:   append([]byte{}, raw...),
+		Err:   err,
+	}
+}
+
+// validate checks the values of id and retry fields against the rules of the
+// spec: an id must not contain NUL, and retry must consist of ASCII digits.
+func validate(field string, value []byte) error {
+	switch field {
+	case "id":
+		if bytes.IndexByte(value, 0) >= 0 {
+			return ErrInvalidID
+		}
+	case "retry":
+		if len(value) == 0 {
+			return ErrInvalidRetry
+		}
+
+		for _, b := range value {
+			if b < '0' || b > '9' {
+				return ErrInvalidRetry
+			}
+		}
+	}
 
-	// set default event type
-	e.Type = "message"
+	return nil
+}
+
+// ReadField reads a single line from the stream and parses it as a field. A
+// complete event is signalled by an empty key and value. The returned error
+// may either be an error from the stream, ErrEventTooLarge if the line
+// exceeds the decoder's limit, or a *DecodeError wrapping ErrInvalidEncoding
+// if the line is not valid UTF-8.
+func (d *Decoder) ReadField() (field string, value []byte, err error) {
+	f, v, err := d.readField(d.lineLimit(0))
+
+	if f == nil {
+		return "", nil, err
+	}
+
+	if v != nil {
+		value = append([]byte{}, v...)
+	}
+
+	return string(f), value, err
+}
+
+// Next reads the next event from its input. Unless KeepExtraFields is set,
+// it does so without allocating once the decoder's buffers have grown to fit.
+// The returned event is only valid until the next call to the decoder. If the
+// event exceeds the decoder's limits or is otherwise invalid, the rest of it
+// is skipped and ErrEventTooLarge or a *DecodeError returned, so that
+// decoding can continue with the next event.
+func (d *Decoder) Next() (RawEvent, error) {
+	if err := d.drain(); err != nil {
+		return RawEvent{}, err
+	}
+
+	e := RawEvent{Type: messageType}
+	d.typ, d.id, d.retry, d.data = d.typ[:0], d.id[:0], d.retry[:0], d.data[:0]
+	d.extra = d.extra[:0]
+
+	var wroteData bool
+	var size int
+	var skip error
 
 	for {
-		field, value, err := d.ReadField()
+		field, value, err := d.readField(d.lineLimit(size))
+
+		if err == ErrEventTooLarge || errors.Is(err, ErrInvalidEncoding) {
+			if skip == nil {
+				skip = err
+			}
+			continue
+		}
 
 		if err != nil {
-			return err
+			return RawEvent{}, err
 		}
 
-		if len(field) == 0 && len(value) == 0 {
+		if field == nil {
 			break
 		}
 
-		switch field {
-		case "id":
-			e.ID = string(value)
-			if len(e.ID) == 0 {
-				e.ResetID = true
+		size += len(field) + len(value) + 1
+		if d.maxEvent > 0 && size > d.maxEvent && skip == nil {
+			skip = ErrEventTooLarge
+		}
+
+		if skip != nil {
+			continue
+		}
+
+		if err := validate(string(field), value); err != nil {
+			if d.strict {
+				skip = d.decodeError(string(field), d.line, err)
 			}
+			continue
+		}
+
+		switch string(field) {
+		case "id":
+			d.id = append(d.id[:0], value...)
+			e.ID = d.id
+			e.ResetID = len(value) == 0
 		case "retry":
-			e.Retry = string(value)
+			d.retry = append(d.retry[:0], value...)
+			e.Retry = d.retry
 		case "event":
-			e.Type = string(value)
+			d.typ = append(d.typ[:0], value...)
+			e.Type = d.typ
 		case "data":
 			if wroteData {
-				e.Data = append(e.Data, '\n')
+				d.data = append(d.data, '\n')
 			} else {
 				wroteData = true
 			}
-			e.Data = append(e.Data, value...)
+			d.data = append(d.data, value...)
+			e.Data = d.data
+		default:
+			if d.keepExtra {
+				d.extra = append(d.extra, newField(field, value))
+				e.Extra = d.extra
+			}
 		}
 	}
 
+	if skip != nil {
+		return RawEvent{}, skip
+	}
+
+	return e, nil
+}
+
+// newField copies a field's name and value.
+func newField(name, value []byte) Field {
+	f := Field{Name: string(name)}
+
+	if value != nil {
+		f.Value = append([]byte{}, value...)
+	}
+
+	return f
+}
+
+// DecodeInto is like Decode, but reuses the memory already held by e where
+// possible, so that decoding a stream into the same Event does not allocate
+// once it has grown to fit. Any previous contents of e are overwritten.
+func (d *Decoder) DecodeInto(e *Event) error {
+	raw, err := d.Next()
+
+	if err != nil {
+		return err
+	}
+
+	e.Type = reuse(e.Type, raw.Type)
+	e.ID = reuse(e.ID, raw.ID)
+	e.Retry = reuse(e.Retry, raw.Retry)
+	e.Data = append(e.Data[:0], raw.Data...)
+	e.ResetID = raw.ResetID
+	e.Extra = append(e.Extra[:0], raw.Extra...)
+
+	return nil
+}
+
+// reuse returns s if it already holds b, to avoid allocating a new string.
+func reuse(s string, b []byte) string {
+	if s == string(b) {
+		return s
+	}
+
+	return string(b)
+}
+
+// Decode reads the next event from its input and stores it in the provided
+// Event pointer. If the event exceeds the decoder's limits or is otherwise
+// invalid, the rest of it is skipped and ErrEventTooLarge or a *DecodeError
+// returned, so that decoding can continue with the next event.
+func (d *Decoder) Decode(e *Event) error {
+	raw, err := d.Next()
+
+	if err != nil {
+		return err
+	}
+
+	*e = Event{
+		Type:    string(raw.Type),
+		ID:      string(raw.ID),
+		Retry:   string(raw.Retry),
+		ResetID: raw.ResetID,
+	}
+
+	if len(raw.Data) > 0 {
+		e.Data = append([]byte{}, raw.Data...)
+	}
+
+	if len(raw.Extra) > 0 {
+		e.Extra = append([]Field{}, raw.Extra...)
+	}
+
 	return nil
 }
@@ -2,8 +2,13 @@ package eventsource
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func longLine() string {
@@ -37,7 +42,7 @@ func TestDecoderReadField(t *testing.T) {
 
 		field, value, err := dec.ReadField()
 
-		if err != tt.err {
+		if !errors.Is(err, tt.err) {
 			t.Errorf("%d. expected err=%q, got %q", i, tt.err, err)
 			continue
 		}
@@ -78,3 +83,331 @@ func TestDecoderDecode(t *testing.T) {
 		}
 	}
 }
+
+func decodeAll(dec *Decoder) ([]Event, error) {
+	var events []Event
+
+	for {
+		var event Event
+
+		if err := dec.Decode(&event); err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+}
+
+// Parsing examples from the WHATWG HTML standard, §9.2.5.
+func TestDecoderSpecExamples(t *testing.T) {
+	table := []struct {
+		in  string
+		out []Event
+	}{
+		{
+			"data: YHOO\ndata: +2\ndata: 10\n\n",
+			[]Event{{Type: "message", Data: []byte("YHOO\n+2\n10")}},
+		},
+		{
+			": test stream\n\ndata: first event\nid: 1\n\ndata:second event\nid\n\ndata:  third event\n",
+			[]Event{
+				{Type: "message"},
+				{Type: "message", ID: "1", Data: []byte("first event")},
+				{Type: "message", ResetID: true, Data: []byte("second event")},
+			},
+		},
+		{
+			"data\n\ndata\ndata\n\ndata:",
+			[]Event{
+				{Type: "message"},
+				{Type: "message", Data: []byte("\n")},
+			},
+		},
+		{
+			"data:test\n\ndata: test\n\n",
+			[]Event{
+				{Type: "message", Data: []byte("test")},
+				{Type: "message", Data: []byte("test")},
+			},
+		},
+	}
+
+	for i, tt := range table {
+		for _, eol := range []string{"\n", "\r", "\r\n"} {
+			in := strings.Replace(tt.in, "\n", eol, -1)
+
+			for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+				events, err := decodeAll(NewDecoder(r))
+
+				if err != io.EOF {
+					t.Errorf("%d. %q: unexpected error %v", i, in, err)
+				}
+
+				if !reflect.DeepEqual(events, tt.out) {
+					t.Errorf("%d. %q: expected %#v, got %#v", i, in, tt.out, events)
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderMixedLineEndings(t *testing.T) {
+	in := "data: a\r\rdata: b\n\ndata: c\r\n\r\n"
+	events, _ := decodeAll(NewDecoder(iotest.OneByteReader(strings.NewReader(in))))
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	for i, data := range []string{"a", "b", "c"} {
+		if string(events[i].Data) != data {
+			t.Errorf("%d. expected data = %q, got %q", i, data, events[i].Data)
+		}
+	}
+}
+
+func TestDecoderTrailingCR(t *testing.T) {
+	r, w := io.Pipe()
+	dec := NewDecoder(r)
+
+	go w.Write([]byte("data: a\r\r"))
+
+	done := make(chan error)
+	go func() {
+		var event Event
+		done <- dec.Decode(&event)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("decoder waited for a possible LF after CR")
+	}
+
+	// the LF completing the CRLF pair must not end an empty line
+	go func() {
+		w.Write([]byte("\ndata: b\r\n\r\n"))
+		w.Close()
+	}()
+
+	var event Event
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(event.Data) != "b" {
+		t.Errorf("expected data = b, got %q", event.Data)
+	}
+}
+
+func TestDecoderSize(t *testing.T) {
+	table := []struct {
+		in                string
+		maxLine, maxEvent int
+		errs              []error
+	}{
+		{"data: short\n\n", 16, 32, []error{nil}},
+		{"data: " + longLine() + "\n\ndata: short\n\n", 16, 0, []error{ErrEventTooLarge, nil}},
+		{"data: 0123456789\ndata: 0123456789\n\ndata: short\n\n", 0, 24, []error{ErrEventTooLarge, nil}},
+		{"data: " + longLine(), 16, 0, nil},
+	}
+
+	for i, tt := range table {
+		dec := NewDecoderSize(strings.NewReader(tt.in), tt.maxLine, tt.maxEvent)
+
+		for j, exp := range tt.errs {
+			var event Event
+			err := dec.Decode(&event)
+
+			if err != exp {
+				t.Errorf("%d.%d expected err = %v, got %v", i, j, exp, err)
+			}
+
+			if err == nil && string(event.Data) != "short" {
+				t.Errorf("%d.%d expected data = short, got %q", i, j, event.Data)
+			}
+		}
+
+		var event Event
+		if err := dec.Decode(&event); err != io.EOF {
+			t.Errorf("%d. expected EOF, got %v", i, err)
+		}
+	}
+}
+
+func TestDecoderEventSizeBoundsLine(t *testing.T) {
+	in := "data: " + strings.Repeat(longLine(), 256) + "\n\ndata: short\n\n"
+	dec := NewDecoderSize(strings.NewReader(in), 0, 512)
+
+	var event Event
+	if err := dec.Decode(&event); err != ErrEventTooLarge {
+		t.Errorf("expected err = %v, got %v", ErrEventTooLarge, err)
+	}
+
+	if cap(dec.line) > 1024 {
+		t.Errorf("expected the line buffer to stay within the event limit, got %d bytes", cap(dec.line))
+	}
+
+	if err := dec.Decode(&event); err != nil || string(event.Data) != "short" {
+		t.Errorf("expected next event, got %#v (err = %v)", event, err)
+	}
+}
+
+func TestDecoderNext(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("id: 1\nevent: add\ndata: a\ndata: b\n\n:\ndata: c\n\n"))
+
+	e, err := dec.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(e.ID) != "1" || string(e.Type) != "add" || string(e.Data) != "a\nb" {
+		t.Errorf("unexpected event %#v", e)
+	}
+
+	// a bare colon is a comment, not the end of the event
+	e, err = dec.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.ID != nil || string(e.Type) != "message" || string(e.Data) != "c" {
+		t.Errorf("unexpected event %#v", e)
+	}
+}
+
+func TestDecoderDecodeIntoAllocs(t *testing.T) {
+	stream := strings.Repeat("id: 1\nevent: add\ndata: some data\n\n", 100)
+	r := strings.NewReader(stream)
+	dec := NewDecoder(r)
+
+	var event Event
+	dec.DecodeInto(&event)
+
+	allocs := testing.AllocsPerRun(50, func() {
+		if err := dec.DecodeInto(&event); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+
+	if event.ID != "1" || event.Type != "add" || string(event.Data) != "some data" {
+		t.Errorf("unexpected event %#v", event)
+	}
+}
+
+func TestDecoderPosition(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("\xEF\xBB\xBFid: 1\r\ndata: ok\r\n\r\nid: 2\rdata: \xFF\n\n"))
+
+	var event Event
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	// the LF of the final CRLF has not been read yet
+	if exp, got := (Position{Line: 4, Offset: 21}), dec.Position(); exp != got {
+		t.Errorf("expected position %v, got %v", exp, got)
+	}
+
+	err := dec.Decode(&event)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected DecodeError, got %v", err)
+	}
+
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("expected error to wrap ErrInvalidEncoding")
+	}
+
+	if exp := (Position{Line: 5, Offset: 28}); decodeErr.Pos != exp {
+		t.Errorf("expected position %v, got %v", exp, decodeErr.Pos)
+	}
+
+	if decodeErr.Field != "data" || string(decodeErr.Raw) != "data: \xFF" {
+		t.Errorf("unexpected error details %#v", decodeErr)
+	}
+
+	if exp, got := (Position{Line: 7, Offset: 37}), dec.Position(); exp != got {
+		t.Errorf("expected position %v, got %v", exp, got)
+	}
+}
+
+func TestDecoderKeepExtraFields(t *testing.T) {
+	in := ": hello\ncustom: value\ndata: a\nflag\n:\n\n"
+	expected := []Field{
+		{"", []byte("hello")},
+		{"custom", []byte("value")},
+		{"flag", nil},
+		{"", []byte{}},
+	}
+
+	dec := NewDecoder(strings.NewReader(in))
+
+	var event Event
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Extra != nil {
+		t.Errorf("expected extra fields to be discarded, got %q", event.Extra)
+	}
+
+	dec = NewDecoder(strings.NewReader(in))
+	dec.KeepExtraFields()
+
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(event.Extra, expected) {
+		t.Errorf("expected extra fields %q, got %q", expected, event.Extra)
+	}
+}
+
+func TestDecoderFieldValidation(t *testing.T) {
+	table := []struct {
+		in     string
+		out    Event
+		strict error
+	}{
+		{"retry: 100\ndata\n\n", Event{Type: "message", Retry: "100"}, nil},
+		{"retry: -5\ndata\n\n", Event{Type: "message"}, ErrInvalidRetry},
+		{"retry: +10\ndata\n\n", Event{Type: "message"}, ErrInvalidRetry},
+		{"retry: 1.5\ndata\n\n", Event{Type: "message"}, ErrInvalidRetry},
+		{"retry\ndata\n\n", Event{Type: "message"}, ErrInvalidRetry},
+		{"id: 1\x002\ndata\n\n", Event{Type: "message"}, ErrInvalidID},
+		{"id: 1\nid: 2\x00\ndata\n\n", Event{Type: "message", ID: "1"}, ErrInvalidID},
+	}
+
+	for i, tt := range table {
+		var event Event
+		if err := NewDecoder(strings.NewReader(tt.in)).Decode(&event); err != nil {
+			t.Errorf("%d. unexpected error %v", i, err)
+		} else if !reflect.DeepEqual(event, tt.out) {
+			t.Errorf("%d. expected %#v, got %#v", i, tt.out, event)
+		}
+
+		dec := NewDecoder(strings.NewReader(tt.in + "data: next\n\n"))
+		dec.Strict()
+
+		if err := dec.Decode(&event); !errors.Is(err, tt.strict) {
+			t.Errorf("%d. expected strict err = %v, got %v", i, tt.strict, err)
+		}
+
+		if tt.strict == nil {
+			continue
+		}
+
+		// the rest of the invalid event is skipped
+		if err := dec.Decode(&event); err != nil || string(event.Data) != "next" {
+			t.Errorf("%d. expected next event, got %#v (err = %v)", i, event, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package eventsource
+
+import (
+	"context"
+	"sync"
+)
+
+// A Dispatcher reads events from an EventSource and delivers them to the
+// listeners registered for their type, like addEventListener in browsers.
+// Listeners may be added and removed at any time, including from within a
+// listener.
+type Dispatcher struct {
+	es *EventSource
+
+	mu        sync.RWMutex
+	listeners map[string][]*listener
+}
+
+type listener struct {
+	f func(Event)
+}
+
+// NewDispatcher returns a dispatcher for events read from es.
+func NewDispatcher(es *EventSource) *Dispatcher {
+	return &Dispatcher{
+		es:        es,
+		listeners: make(map[string][]*listener),
+	}
+}
+
+// AddListener registers f to be called with every event of type typ. The
+// returned function removes the listener; once it returns, f will not be
+// called for any subsequently dispatched event.
+func (d *Dispatcher) AddListener(typ string, f func(Event)) (remove func()) {
+	l := &listener{f}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// listener slices are never modified in place, so Run can call them
+	// without holding the lock
+	ls := d.listeners[typ]
+	d.listeners[typ] = append(ls[:len(ls):len(ls)], l)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.remove(typ, l) })
+	}
+}
+
+func (d *Dispatcher) remove(typ string, l *listener) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var ls []*listener
+	for _, other := range d.listeners[typ] {
+		if other != l {
+			ls = append(ls, other)
+		}
+	}
+
+	if len(ls) == 0 {
+		delete(d.listeners, typ)
+	} else {
+		d.listeners[typ] = ls
+	}
+}
+
+// OnMessage registers f to be called with every event of the default
+// "message" type.
+func (d *Dispatcher) OnMessage(f func(Event)) (remove func()) {
+	return d.AddListener("message", f)
+}
+
+// Run reads events and dispatches them, in order, until ctx is done or the
+// EventSource fails, and returns the error which stopped it. Listeners are
+// called sequentially from the goroutine calling Run.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		e, err := d.es.ReadContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		d.dispatch(e)
+	}
+}
+
+func (d *Dispatcher) dispatch(e Event) {
+	d.mu.RLock()
+	ls := d.listeners[e.Type]
+	d.mu.RUnlock()
+
+	for _, l := range ls {
+		if d.active(e.Type, l) {
+			l.f(e)
+		}
+	}
+}
+
+// active reports whether l is still registered, in case an earlier listener
+// for the same event removed it.
+func (d *Dispatcher) active(typ string, l *listener) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, other := range d.listeners[typ] {
+		if other == l {
+			return true
+		}
+	}
+
+	return false
+}
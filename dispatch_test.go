@@ -0,0 +1,79 @@
+package eventsource
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDispatcher(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+
+		enc := NewEncoder(w)
+		enc.Encode(Event{Data: []byte("1")})
+		enc.Encode(Event{Type: "add", Data: []byte("2")})
+		enc.Encode(Event{Type: "remove", Data: []byte("3")})
+		enc.Encode(Event{Type: "add", Data: []byte("4")})
+		enc.Encode(Event{Data: []byte("5")})
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+	d := NewDispatcher(es)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	record := func(e Event) {
+		got = append(got, e.Type+" "+string(e.Data))
+	}
+
+	d.OnMessage(func(e Event) {
+		record(e)
+		if string(e.Data) == "5" {
+			cancel()
+		}
+	})
+
+	var removeAdd func()
+	removeAdd = d.AddListener("add", func(e Event) {
+		record(e)
+		removeAdd()
+	})
+
+	d.AddListener("remove", func(e Event) {
+		record(e)
+		// added while running
+		d.AddListener("add", record)
+	})
+
+	if err := d.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected err = %v, got %v", context.Canceled, err)
+	}
+
+	expected := []string{"message 1", "add 2", "remove 3", "add 4", "message 5"}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDispatcherRemoveDuringDispatch(t *testing.T) {
+	d := NewDispatcher(nil)
+
+	var calls int
+	var removeSecond func()
+
+	d.OnMessage(func(Event) { removeSecond() })
+	removeSecond = d.OnMessage(func(Event) { calls++ })
+
+	d.dispatch(Event{Type: "message"})
+
+	if calls != 0 {
+		t.Fatal("removed listener was called")
+	}
+}
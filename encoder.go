@@ -2,8 +2,11 @@ package eventsource
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
+	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 )
 
@@ -20,83 +23,316 @@ type noopFlusher struct {
 
 func (noopFlusher) Flush() {}
 
-// Encoder writes EventSource events to an output stream.
+// Encoder writes EventSource events to an output stream. It is safe for
+// concurrent use: each call to Encode writes its whole event at once, so
+// events written from different goroutines are never interleaved. A sequence
+// of WriteField and Flush calls is not atomic, however.
 type Encoder struct {
-	w FlushWriter
+	mu        sync.Mutex
+	w         FlushWriter
+	buf       []byte    // reused by Encode, under mu
+	lastWrite time.Time // under mu
+	partial   bool      // fields written without ending the event, under mu
+
+	now func() time.Time
 }
 
+// maxBufferSize is the largest buffer an Encoder keeps for reuse, so that one
+// huge event doesn't pin its memory for the life of the connection.
+const maxBufferSize = 64 << 10
+
 // NewEncoder returns a new encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
 	if w, ok := w.(FlushWriter); ok {
-		return &Encoder{w}
+		return &Encoder{w: w, lastWrite: time.Now(), now: time.Now}
+	}
+
+	return &Encoder{w: noopFlusher{w}, lastWrite: time.Now(), now: time.Now}
+}
+
+// write writes buf to the connection in a single call. If end is true, buf
+// completes an event, and the connection is flushed.
+func (e *Encoder) write(buf []byte, end bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := e.w.Write(buf)
+	e.lastWrite = e.now()
+	e.partial = !end
+
+	if end {
+		e.w.Flush()
+	}
+
+	return err
+}
+
+// keepAlive writes an empty comment whenever nothing has been written for
+// interval, until ctx is done or a write fails.
+func (e *Encoder) keepAlive(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	t := time.NewTimer(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		wait, err := e.heartbeat(interval)
+
+		if err != nil {
+			return
+		}
+
+		t.Reset(wait)
+	}
+}
+
+// heartbeat writes an empty comment if nothing has been written for interval,
+// and returns how long to wait before checking again. Since each event is
+// written at once under the encoder's lock, a heartbeat can't split one;
+// between events, the comment is followed by a blank line so that clients
+// observe it straight away, but not while an event is being written field by
+// field.
+func (e *Encoder) heartbeat(interval time.Duration) (time.Duration, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if idle := e.now().Sub(e.lastWrite); idle < interval {
+		return interval - idle, nil
 	}
 
-	return &Encoder{noopFlusher{w}}
+	heartbeat := ":\n\n"
+	if e.partial {
+		heartbeat = ":\n"
+	}
+
+	_, err := e.w.Write([]byte(heartbeat))
+	e.w.Flush()
+	e.lastWrite = e.now()
+
+	return interval, err
 }
 
 // Flush sends an empty line to signal event is complete, and flushes the
 // writer.
 func (e *Encoder) Flush() error {
-	_, err := e.w.Write([]byte{'\n'})
-	e.w.Flush()
-	return err
+	return e.write([]byte{'\n'}, true)
 }
 
 // WriteField writes an event field to the connection. If the provided value
-// contains newlines, multiple fields will be emitted. If the returned error is
-// not nil, it will be either ErrInvalidEncoding or an error from the
-// connection.
+// contains line breaks (CR, LF or CRLF), multiple fields will be emitted. If
+// the returned error is not nil, it will be either ErrInvalidEncoding,
+// ErrInvalidField if the field name contains a colon or line break, or an
+// error from the connection.
 func (e *Encoder) WriteField(field string, value []byte) error {
+	buf, err := appendField(nil, field, value)
+
+	if err != nil {
+		return err
+	}
+
+	return e.write(buf, false)
+}
+
+// appendField appends a field to buf, as WriteField would write it.
+func appendField(buf []byte, field string, value []byte) ([]byte, error) {
 	if !utf8.ValidString(field) || !utf8.Valid(value) {
-		return ErrInvalidEncoding
+		return buf, ErrInvalidEncoding
 	}
 
-	for _, line := range bytes.Split(value, []byte{'\n'}) {
-		if len(line) > 0 && line[len(line)-1] == '\r' {
-			line = line[:len(line)-1]
+	if strings.ContainsAny(field, ":\r\n") {
+		return buf, ErrInvalidField
+	}
+
+	// split on CR, LF and CRLF, as the decoder does, so that no line break
+	// reaches the stream within a value
+	for {
+		i := bytes.IndexAny(value, "\r\n")
+
+		if i < 0 {
+			return appendLine(buf, field, value), nil
 		}
 
-		if err := e.writeField(field, line); err != nil {
-			return err
+		buf = appendLine(buf, field, value[:i])
+
+		if value[i] == '\r' && i+1 < len(value) && value[i+1] == '\n' {
+			i++
 		}
+
+		value = value[i+1:]
 	}
+}
 
-	return nil
+// appendSingleField appends a field whose value is known not to contain line
+// breaks.
+func appendSingleField(buf []byte, field, value string) ([]byte, error) {
+	if !utf8.ValidString(value) {
+		return buf, ErrInvalidEncoding
+	}
+
+	buf = append(buf, field...)
+
+	if len(value) > 0 {
+		buf = append(buf, ": "...)
+		buf = append(buf, value...)
+	}
+
+	return append(buf, '\n'), nil
 }
 
-func (e *Encoder) writeField(field string, value []byte) (err error) {
-	if len(value) == 0 {
-		_, err = fmt.Fprintf(e.w, "%s\n", field)
-	} else {
-		_, err = fmt.Fprintf(e.w, "%s: %s\n", field, value)
+func appendLine(buf []byte, field string, value []byte) []byte {
+	if len(field) == 0 && len(value) == 0 {
+		// an empty comment; a bare newline would end the event
+		return append(buf, ":\n"...)
 	}
 
-	return
+	buf = append(buf, field...)
+
+	if len(value) > 0 {
+		buf = append(buf, ": "...)
+		buf = append(buf, value...)
+	}
+
+	return append(buf, '\n')
 }
 
-// Encode writes an event to the connection.
-func (e *Encoder) Encode(event Event) error {
+// validateEvent checks that the event can be written without one field
+// spilling into another, and that no extra field poses as a standard one.
+func validateEvent(event Event) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") ||
+		strings.ContainsAny(event.Type, "\r\n") ||
+		strings.ContainsAny(event.Retry, "\r\n") {
+		return ErrInvalidField
+	}
+
+	for _, f := range event.Extra {
+		switch f.Name {
+		case "id", "event", "data", "retry":
+			return ErrInvalidField
+		}
+	}
+
+	return nil
+}
+
+// appendEvent appends a complete event to buf, as Encode would write it.
+func appendEvent(buf []byte, event Event) ([]byte, error) {
+	if err := validateEvent(event); err != nil {
+		return buf, err
+	}
+
+	var err error
+
+	for _, f := range event.Extra {
+		if buf, err = appendField(buf, f.Name, f.Value); err != nil {
+			return buf, err
+		}
+	}
+
 	if event.ResetID || len(event.ID) > 0 {
-		if err := e.WriteField("id", []byte(event.ID)); err != nil {
-			return err
+		if buf, err = appendSingleField(buf, "id", event.ID); err != nil {
+			return buf, err
 		}
 	}
 
 	if len(event.Retry) > 0 {
-		if err := e.WriteField("retry", []byte(event.Retry)); err != nil {
-			return err
+		if buf, err = appendSingleField(buf, "retry", event.Retry); err != nil {
+			return buf, err
 		}
 	}
 
 	if len(event.Type) > 0 {
-		if err := e.WriteField("event", []byte(event.Type)); err != nil {
-			return err
+		if buf, err = appendSingleField(buf, "event", event.Type); err != nil {
+			return buf, err
 		}
 	}
 
-	if err := e.WriteField("data", event.Data); err != nil {
+	if buf, err = appendField(buf, "data", event.Data); err != nil {
+		return buf, err
+	}
+
+	return append(buf, '\n'), nil
+}
+
+// Encode writes an event to the connection, starting with its comments and
+// extra fields, and flushes it. The event is serialised into a buffer reused
+// across calls, and written with a single call to the underlying writer. If
+// the event's id, type or retry value contain a line break, or an extra field
+// is named id, event, data or retry, ErrInvalidField is returned and nothing
+// is written.
+func (e *Encoder) Encode(event Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	buf, err := appendEvent(e.buf[:0], event)
+
+	if cap(buf) <= maxBufferSize {
+		e.buf = buf
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(buf)
+	e.lastWrite = e.now()
+	e.partial = false
+	e.w.Flush()
+	return err
+}
+
+// A Batch collects events to be written to an Encoder's connection together,
+// with a single write and flush.
+type Batch struct {
+	e   *Encoder
+	buf []byte
+	n   int
+}
+
+// Batch returns a new, empty batch for the encoder.
+func (e *Encoder) Batch() *Batch {
+	return &Batch{e: e}
+}
+
+// Encode adds an event to the batch. If the event cannot be encoded, the
+// error is returned as by Encoder.Encode, and the batch is left unchanged.
+func (b *Batch) Encode(event Event) error {
+	buf, err := appendEvent(b.buf, event)
+
+	if err != nil {
 		return err
 	}
 
-	return e.Flush()
+	b.buf = buf
+	b.n++
+	return nil
+}
+
+// Len returns the number of events in the batch.
+func (b *Batch) Len() int {
+	return b.n
+}
+
+// Flush writes the batched events to the connection and flushes it, leaving
+// the batch empty and ready for reuse.
+func (b *Batch) Flush() error {
+	if b.n == 0 {
+		return nil
+	}
+
+	err := b.e.write(b.buf, true)
+	b.buf, b.n = b.buf[:0], 0
+
+	if cap(b.buf) > maxBufferSize {
+		b.buf = nil
+	}
+
+	return err
 }
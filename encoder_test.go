@@ -3,7 +3,10 @@ package eventsource
 import (
 	"bytes"
 	"io"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 type testFlusher struct {
@@ -43,6 +46,11 @@ func TestWriteField(t *testing.T) {
 		{"data", []byte("\xFF\xFE\xFD"), "", ErrInvalidEncoding},
 		{"data", []byte("a\nb\nc\n"), "data: a\ndata: b\ndata: c\ndata\n", nil},
 		{"data", []byte("a\r\nb\r\nc"), "data: a\ndata: b\ndata: c\n", nil},
+		{"data", []byte("a\rb\r\rc\r"), "data: a\ndata: b\ndata\ndata: c\ndata\n", nil},
+		{"", []byte("c\rdata: injected"), ": c\n: data: injected\n", nil},
+		{"da:ta", []byte("data"), "", ErrInvalidField},
+		{"data\nid", []byte("1"), "", ErrInvalidField},
+		{"", []byte("comment"), ": comment\n", nil},
 	}
 
 	for i, tt := range table {
@@ -90,3 +98,216 @@ func TestEncoderEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestEncoderEncodeExtra(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	event := Event{
+		Type: "type",
+		Data: []byte("data"),
+		Extra: []Field{
+			{"", []byte("comment")},
+			{"custom", []byte("value")},
+			{"", nil},
+		},
+	}
+
+	if err := NewEncoder(buf).Encode(event); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ": comment\ncustom: value\n:\nevent: type\ndata: data\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestEncoderEncodeInjection(t *testing.T) {
+	table := []Event{
+		{Type: "type\ndata: injected"},
+		{Type: "type\rdata: injected"},
+		{ID: "1\nevent: injected"},
+		{ID: "1\x00"},
+		{Retry: "10\ndata: injected"},
+		{Extra: []Field{{"x:y", nil}}},
+		{Extra: []Field{{"id", []byte("99")}}},
+		{Extra: []Field{{"event", []byte("evil")}}},
+		{Extra: []Field{{"data", []byte("injected")}}},
+		{Extra: []Field{{"retry", []byte("1")}}},
+	}
+
+	for i, event := range table {
+		buf := new(bytes.Buffer)
+		event.Data = []byte("data")
+
+		if err := NewEncoder(buf).Encode(event); err != ErrInvalidField {
+			t.Errorf("%d. expected err = %v, got %v", i, ErrInvalidField, err)
+		}
+
+		if buf.Len() > 0 {
+			t.Errorf("%d. expected nothing to be written, got %q", i, buf.String())
+		}
+	}
+
+	// line breaks in data, comments and extra values split the field instead
+	split := []Event{
+		{Type: "safe", Data: []byte("x\revent: evil\rid: 99")},
+		{Type: "safe", Data: []byte("x\r\nevent: evil\nid: 99")},
+		{Type: "safe", Extra: []Field{{"", []byte("c\revent: evil\rid: 99")}}},
+		{Type: "safe", Extra: []Field{{"custom", []byte("v\revent: evil\rid: 99")}}},
+	}
+
+	for i, event := range split {
+		buf := new(bytes.Buffer)
+
+		if err := NewEncoder(buf).Encode(event); err != nil {
+			t.Errorf("%d. unexpected error %v", i, err)
+			continue
+		}
+
+		var decoded Event
+		if err := NewDecoder(buf).Decode(&decoded); err != nil {
+			t.Errorf("%d. unexpected error %v", i, err)
+			continue
+		}
+
+		if decoded.Type != "safe" || decoded.ID != "" {
+			t.Errorf("%d. line break in a value injected fields: %#v", i, decoded)
+		}
+	}
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncoderConcurrentEncode(t *testing.T) {
+	w := new(countingWriter)
+	enc := NewEncoder(w)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				enc.Encode(Event{
+					ID:   strconv.Itoa(i),
+					Type: "type" + strconv.Itoa(i),
+					Data: []byte(strconv.Itoa(i) + "\n" + strconv.Itoa(i)),
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if w.writes != 1000 {
+		t.Errorf("expected one write per event, got %d writes", w.writes)
+	}
+
+	dec := NewDecoder(&w.Buffer)
+	for n := 0; n < 1000; n++ {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+
+		i := event.ID
+		if event.Type != "type"+i || string(event.Data) != i+"\n"+i {
+			t.Fatalf("event %d was interleaved: %#v", n, event)
+		}
+	}
+}
+
+func TestEncoderBatch(t *testing.T) {
+	w := new(countingWriter)
+	enc := NewEncoder(w)
+	batch := enc.Batch()
+
+	batch.Encode(Event{ID: "1", Data: []byte("a")})
+
+	if err := batch.Encode(Event{Type: "bad\ntype"}); err != ErrInvalidField {
+		t.Errorf("expected err = %v, got %v", ErrInvalidField, err)
+	}
+
+	batch.Encode(Event{ID: "2", Data: []byte("b")})
+
+	if batch.Len() != 2 {
+		t.Errorf("expected 2 batched events, got %d", batch.Len())
+	}
+
+	if w.writes != 0 {
+		t.Fatal("batch was written before flush")
+	}
+
+	if err := batch.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "id: 1\ndata: a\n\nid: 2\ndata: b\n\n"; w.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.String())
+	}
+
+	if w.writes != 1 || batch.Len() != 0 {
+		t.Errorf("expected a single write and an empty batch, got %d writes and %d events", w.writes, batch.Len())
+	}
+}
+
+func TestEncoderEncodeAllocs(t *testing.T) {
+	enc := NewEncoder(io.Discard)
+	event := Event{ID: "1", Type: "type", Data: []byte("some data\nmore data")}
+	enc.Encode(event)
+
+	allocs := testing.AllocsPerRun(50, func() {
+		enc.Encode(event)
+	})
+
+	if allocs != 0 {
+		t.Errorf("expected the encode buffer to be reused, got %v allocations", allocs)
+	}
+}
+
+func TestEncoderHeartbeat(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.now = func() time.Time { return now }
+	enc.lastWrite = now
+
+	step := func(d, wait time.Duration, out string) {
+		t.Helper()
+		now = now.Add(d)
+
+		if got, err := enc.heartbeat(10 * time.Second); err != nil || got != wait {
+			t.Errorf("expected to wait %v, got %v (err = %v)", wait, got, err)
+		}
+
+		if buf.String() != out {
+			t.Errorf("expected %q, got %q", out, buf.String())
+		}
+
+		buf.Reset()
+	}
+
+	step(5*time.Second, 5*time.Second, "")
+	step(5*time.Second, 10*time.Second, ":\n\n")
+
+	// an event written recently postpones the heartbeat
+	now = now.Add(5 * time.Second)
+	enc.Encode(Event{Data: []byte("event")})
+	buf.Reset()
+	step(3*time.Second, 7*time.Second, "")
+
+	// a heartbeat while an event is partly written doesn't end it
+	enc.WriteField("data", []byte("partial"))
+	buf.Reset()
+	step(10*time.Second, 10*time.Second, ":\n")
+}
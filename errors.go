@@ -0,0 +1,112 @@
+package eventsource
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A StatusError is returned when the endpoint responds with a status other
+// than 200 OK. It is fatal unless the status is 429 or 5xx, in which case it
+// is passed to the reconnect policy.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+
+	// RetryAfter is the delay requested by the Retry-After header, or zero.
+	RetryAfter time.Duration
+}
+
+func statusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// temporary reports whether the request should be retried.
+func (e *StatusError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("endpoint returned status %q", e.Status)
+}
+
+// A ContentTypeError is returned when the endpoint responds with a media type
+// other than text/event-stream.
+type ContentTypeError struct {
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("invalid content type %q", e.ContentType)
+}
+
+// A ReconnectExhaustedError is returned when the reconnect policy gives up.
+// Attempts counts the consecutive failures, and Err is the last of them.
+type ReconnectExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ReconnectExhaustedError) Error() string {
+	return fmt.Sprintf("gave up reconnecting after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e *ReconnectExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// A DecodeError describes a line the Decoder could not decode. Pos is the
+// position of the start of the line, Field its field name, and Raw its
+// contents, without the line terminator.
+type DecodeError struct {
+	Pos   Position
+	Field string
+	Raw   []byte
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: field %q: %s", e.Pos, e.Field, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// A CorruptLogError is returned by FileStore when a segment of its log can't
+// be read. Offset is the position of the first bad record in the file.
+type CorruptLogError struct {
+	Path   string
+	Offset int64
+}
+
+func (e *CorruptLogError) Error() string {
+	return fmt.Sprintf("%s: corrupt event log at offset %d", e.Path, e.Offset)
+}
@@ -0,0 +1,27 @@
+package eventsource
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	table := []struct {
+		in       string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for i, tt := range table {
+		if got := retryAfter(tt.in); got < tt.min || got > tt.max {
+			t.Errorf("%d. expected retryAfter(%q) in [%s, %s], got %s", i, tt.in, tt.min, tt.max, got)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package eventsource
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// An EventReader streams the data of a single event, as returned by
+// Decoder.NextEvent. Reading it yields the event's data lines joined by
+// newlines, consumed lazily from the underlying stream. The data is not
+// checked for valid UTF-8, and the decoder's size limits do not apply to it.
+type EventReader struct {
+	d     *Decoder
+	event Event
+
+	started   bool  // a line of the event has been read
+	inData    bool  // positioned within the value of a data field
+	wroteData bool  // a data field has been seen
+	seps      int   // newlines separating data lines which are due
+	size      int   // bytes of the event's fields other than data
+	err       error // io.EOF once the event is complete
+}
+
+// NextEvent reads the next event's fields up to its first data line, and
+// returns a reader over its data. Any unread data from a previous event is
+// discarded. If a field exceeds the decoder's line limit, or the fields other
+// than data exceed its event limit, the rest of the event is skipped and
+// ErrEventTooLarge returned, by NextEvent or Read. Likewise, a field which is
+// not valid UTF-8, or is rejected by a strict decoder, skips the event with a
+// *DecodeError.
+func (d *Decoder) NextEvent() (*EventReader, error) {
+	if err := d.drain(); err != nil {
+		return nil, err
+	}
+
+	r := &EventReader{d: d, event: Event{Type: "message"}}
+
+	if err := r.advance(); err != nil {
+		return nil, err
+	}
+
+	d.cur = r
+	return r, nil
+}
+
+// drain discards the rest of the event being streamed, if any.
+func (d *Decoder) drain() error {
+	r := d.cur
+	if r == nil {
+		return nil
+	}
+
+	d.cur = nil
+
+	// an invalid event has already been skipped
+	var decodeErr *DecodeError
+
+	if _, err := io.Copy(io.Discard, r); err != nil && err != ErrEventTooLarge && !errors.As(err, &decodeErr) {
+		return err
+	}
+
+	return nil
+}
+
+// Event returns the event's metadata; its Data is always nil. Fields which
+// follow the first data line are only reflected once Read has returned
+// io.EOF.
+func (r *EventReader) Event() Event {
+	return r.event
+}
+
+// Read reads the event's data. It returns io.EOF at the end of the event, or
+// io.ErrUnexpectedEOF if the stream ends first.
+func (r *EventReader) Read(p []byte) (n int, err error) {
+	for n < len(p) && (r.seps > 0 || r.err == nil) {
+		if r.seps > 0 {
+			p[n] = '\n'
+			n++
+			r.seps--
+			continue
+		}
+
+		if !r.inData {
+			if n > 0 {
+				// don't block for the next line with data in hand
+				break
+			}
+
+			if err := r.advance(); err != nil {
+				r.err = err
+			}
+			continue
+		}
+
+		chunk, eol, err := r.d.readChunk(len(p) - n)
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			r.err = err
+			break
+		}
+
+		n += copy(p[n:], chunk)
+		r.inData = !eol
+		break
+	}
+
+	if n > 0 {
+		return n, nil
+	}
+
+	return 0, r.err
+}
+
+// skip discards the rest of the event, so that the next one can be read,
+// and returns err.
+func (r *EventReader) skip(err error) error {
+	if serr := r.d.skipEvent(); serr != nil && serr != io.EOF {
+		return serr
+	}
+
+	return err
+}
+
+// advance reads fields until positioned within the value of the next data
+// line, or the end of the event.
+func (r *EventReader) advance() error {
+	d := r.d
+
+	if !d.checkedBOM {
+		d.checkBOM()
+	}
+
+	for {
+		if err := d.completeCRLF(); err != nil && err != io.EOF {
+			return err
+		}
+
+		d.start = d.pos
+		name, colon, err := d.readName(d.lineLimit(r.size))
+
+		if err == io.EOF && !r.started {
+			return err
+		}
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err == ErrEventTooLarge {
+			return r.skip(err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		r.started = true
+
+		if len(name) == 0 && !colon {
+			r.err = io.EOF
+			return nil
+		}
+
+		field := string(name)
+
+		if field == "data" {
+			if r.wroteData {
+				r.seps++
+			}
+			r.wroteData = true
+
+			if !colon {
+				continue
+			}
+
+			// §7. If value starts with a U+0020 SPACE character, remove it
+			if b, err := d.r.Peek(1); err == nil && b[0] == ' ' {
+				d.r.Discard(1)
+				d.pos.Offset++
+			}
+
+			r.inData = true
+			return nil
+		}
+
+		var raw, value []byte
+
+		if colon {
+			if raw, err = d.readLine(d.lineLimit(r.size + len(name) + 1)); err == ErrEventTooLarge {
+				return r.skip(err)
+			} else if err != nil {
+				return err
+			}
+
+			value = raw
+			if len(value) > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+		}
+
+		r.size += len(field) + len(value) + 1
+		if d.maxEvent > 0 && r.size > d.maxEvent {
+			return r.skip(ErrEventTooLarge)
+		}
+
+		line := append([]byte(field+":"), raw...)
+
+		if !utf8.ValidString(field) || !utf8.Valid(value) {
+			return r.skip(d.decodeError(field, line, ErrInvalidEncoding))
+		}
+
+		if err := validate(field, value); err != nil {
+			if d.strict {
+				return r.skip(d.decodeError(field, line, err))
+			}
+			continue
+		}
+
+		switch field {
+		case "id":
+			r.event.ID = string(value)
+			r.event.ResetID = len(value) == 0
+		case "retry":
+			r.event.Retry = string(value)
+		case "event":
+			r.event.Type = string(value)
+		default:
+			if d.keepExtra {
+				r.event.Extra = append(r.event.Extra, newField([]byte(field), value))
+			}
+		}
+	}
+}
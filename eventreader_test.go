@@ -0,0 +1,195 @@
+package eventsource
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderNextEvent(t *testing.T) {
+	stream := "id: 1\nevent: big\ndata: " + longLine() + longLine() + "\ndata\r\ndata:world\rretry: 5\n\n" +
+		": comment\ndata: skipped\n\n" +
+		"data: last\n\n"
+	dec := NewDecoder(iotest.OneByteReader(strings.NewReader(stream)))
+
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := r.Event(); e.ID != "1" || e.Type != "big" || e.Retry != "" {
+		t.Errorf("unexpected metadata before reading data: %#v", e)
+	}
+
+	data, err := io.ReadAll(iotest.HalfReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := longLine() + longLine() + "\n\nworld"; string(data) != exp {
+		t.Errorf("expected %d bytes of data, got %q", len(exp), data[len(data)-10:])
+	}
+
+	if e := r.Event(); e.Retry != "5" || e.Data != nil {
+		t.Errorf("unexpected metadata after reading data: %#v", e)
+	}
+
+	// the unread data of this event is skipped by the next call
+	if _, err := dec.NextEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := io.ReadAll(r); string(data) != "last" {
+		t.Errorf("expected data = last, got %q", data)
+	}
+
+	if _, err := dec.NextEvent(); err != io.EOF {
+		t.Errorf("expected err = %v, got %v", io.EOF, err)
+	}
+}
+
+func TestDecoderNextEventEmptyData(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("data\ndata\n\n"))
+
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := io.ReadAll(r); string(data) != "\n" {
+		t.Errorf("expected data = %q, got %q", "\n", data)
+	}
+}
+
+func TestDecoderNextEventUnexpectedEOF(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("data: abc"))
+
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(r)
+
+	if string(data) != "abc" {
+		t.Errorf("expected data = abc, got %q", data)
+	}
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected err = %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestDecoderNextEventThenDecode(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("data: a\ndata: b\n\ndata: c\n\n"))
+
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1)
+	r.Read(buf)
+
+	var event Event
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(event.Data) != "c" {
+		t.Errorf("expected data = c, got %q", event.Data)
+	}
+}
+
+func TestDecoderNextEventTooLarge(t *testing.T) {
+	for i, long := range []string{longLine() + ": x", "event: " + longLine()} {
+		in := long + "\nevent: evil\ndata: x\n\ndata: ok\n\n"
+		dec := NewDecoderSize(strings.NewReader(in), 16, 0)
+
+		if _, err := dec.NextEvent(); err != ErrEventTooLarge {
+			t.Errorf("%d. expected err = %v, got %v", i, ErrEventTooLarge, err)
+		}
+
+		// the rest of the oversized event is skipped
+		r, err := dec.NextEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := io.ReadAll(r)
+
+		if r.Event().Type != "message" || string(data) != "ok" {
+			t.Errorf("%d. expected the next event, got %#v with data %q", i, r.Event(), data)
+		}
+	}
+}
+
+func TestDecoderNextEventStrict(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("id: a\x00b\nevent: evil\ndata: x\n\ndata: ok\n\n"))
+	dec.Strict()
+
+	if _, err := dec.NextEvent(); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expected err = %v, got %v", ErrInvalidID, err)
+	}
+
+	// the rest of the rejected event is skipped
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(r)
+
+	if r.Event().Type != "message" || string(data) != "ok" {
+		t.Errorf("expected the next event, got %#v with data %q", r.Event(), data)
+	}
+}
+
+func TestDecoderNextEventExtraTooLarge(t *testing.T) {
+	in := strings.Repeat("x: abcdefgh\n", 8) + "event: evil\ndata: x\n\ndata: ok\n\n"
+	dec := NewDecoderSize(strings.NewReader(in), 0, 32)
+	dec.KeepExtraFields()
+
+	if _, err := dec.NextEvent(); err != ErrEventTooLarge {
+		t.Errorf("expected err = %v, got %v", ErrEventTooLarge, err)
+	}
+
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(r)
+
+	if r.Event().Type != "message" || len(r.Event().Extra) != 0 || string(data) != "ok" {
+		t.Errorf("expected the next event, got %#v with data %q", r.Event(), data)
+	}
+}
+
+func TestDecoderNextEventInvalidEncoding(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("event: \xff\ndata: x\n\ndata: ok\n\n"))
+
+	var decodeErr *DecodeError
+	if _, err := dec.NextEvent(); !errors.As(err, &decodeErr) || !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("expected a DecodeError for %v, got %v", ErrInvalidEncoding, err)
+	}
+
+	// as with Next, the invalid event is skipped
+	r, err := dec.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(r)
+
+	if string(data) != "ok" {
+		t.Errorf("expected the next event, got data %q", data)
+	}
+}
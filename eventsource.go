@@ -3,12 +3,18 @@
 package eventsource
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"io"
+	"iter"
+	"math"
 	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +26,35 @@ var (
 	// ErrInvalidEncoding is returned by Encoder and Decoder when invalid UTF-8
 	// event data is encountered.
 	ErrInvalidEncoding = errors.New("invalid UTF-8 sequence")
+
+	// ErrEventTooLarge is returned by Decoder when a line or event exceeds
+	// its size limits, and by FileStore for an event too large to store.
+	ErrEventTooLarge = errors.New("event too large")
+
+	// ErrInvalidID is reported by a strict Decoder for an id containing
+	// NUL.
+	ErrInvalidID = errors.New("id contains NUL")
+
+	// ErrInvalidRetry is reported by a strict Decoder for a retry value
+	// which is not made up of ASCII digits.
+	ErrInvalidRetry = errors.New("retry is not an integer")
+
+	// ErrInvalidField is returned by Encoder for field names containing a
+	// colon or line break, and for id, event and retry values containing a
+	// line break (or, for ids, NUL), which would corrupt the stream.
+	ErrInvalidField = errors.New("invalid field name or value")
+
+	// ErrSlowSubscriber signals that a Hub dropped a subscription because
+	// it was not keeping up with the events published to it.
+	ErrSlowSubscriber = errors.New("subscriber too slow")
+
+	// ErrNoRequest signals that a RequestFunc returned neither a request
+	// nor an error.
+	ErrNoRequest = errors.New("request func returned no request")
+
+	// ErrTooManyRedirects signals that the event source stopped following
+	// redirects after reaching its limit.
+	ErrTooManyRedirects = errors.New("too many redirects")
 )
 
 // An Event is a message can be written to an event stream and read from an
@@ -30,6 +65,77 @@ type Event struct {
 	Retry   string
 	Data    []byte
 	ResetID bool
+
+	// Extra holds comments and fields other than the above, in order. It
+	// is only populated by decoders configured with KeepExtraFields.
+	Extra []Field
+}
+
+// RetryDuration returns the reconnection time requested by the event's retry
+// field, and whether it held a valid value.
+func (e Event) RetryDuration() (time.Duration, bool) {
+	if len(e.Retry) == 0 || validate("retry", []byte(e.Retry)) != nil {
+		return 0, false
+	}
+
+	ms, err := strconv.ParseInt(e.Retry, 10, 64)
+	if err != nil || ms > math.MaxInt64/int64(time.Millisecond) {
+		// too large to represent
+		return 0, false
+	}
+
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// A Field is an unrecognised field of an event, or a comment if Name is
+// empty.
+type Field struct {
+	Name  string
+	Value []byte
+}
+
+// A RequestFunc prepares the request for each connection attempt. It receives
+// a copy of the request given to New, with the Last-Event-Id header already
+// set, and may modify it or return an entirely new request. attempt is zero
+// for the initial connection, and otherwise numbers reconnects as passed to
+// the ReconnectPolicy. If it returns an error, or a nil request, the attempt
+// fails with that error, or ErrNoRequest.
+type RequestFunc func(req *http.Request, lastEventID string, attempt int) (*http.Request, error)
+
+// An OversizePolicy decides what an EventSource does with events exceeding
+// its size limits.
+type OversizePolicy int
+
+const (
+	// SkipOversized drops the event and continues reading.
+	SkipOversized OversizePolicy = iota
+
+	// FailOversized closes the EventSource with ErrEventTooLarge.
+	FailOversized
+)
+
+// ReadyState describes the state of an EventSource's connection.
+type ReadyState int32
+
+// The ready states of an EventSource, matching the readyState values exposed
+// by browsers.
+const (
+	Connecting ReadyState = iota
+	Open
+	Closed
+)
+
+func (s ReadyState) String() string {
+	switch s {
+	case Connecting:
+		return "CONNECTING"
+	case Open:
+		return "OPEN"
+	case Closed:
+		return "CLOSED"
+	}
+
+	return "ReadyState(" + strconv.Itoa(int(s)) + ")"
 }
 
 // An EventSource consumes server sent events over HTTP with automatic
@@ -41,67 +147,347 @@ type EventSource struct {
 	r           io.ReadCloser
 	dec         *Decoder
 	lastEventID string
+
+	client        *http.Client
+	requestFunc   RequestFunc
+	policy        ReconnectPolicy
+	attempt       int
+	maxRetryAfter time.Duration
+	maxRedirects  int
+	maxLine       int
+	maxEvent      int
+	oversize      OversizePolicy
+	permanentURL  *url.URL
+	moved         bool
+
+	onOpen      func()
+	onError     func(err error, delay time.Duration)
+	onReconnect func(attempt int)
+	onClose     func(err error)
+	onRedirect  func(req *http.Request, via []*http.Request)
+
+	onInvalidEvent func(err error)
+	onComment      func(text string)
+	keepExtra      bool
+
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	state     atomic.Int32
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	connCancel context.CancelFunc
+	eventsErr  error
 }
 
 // New prepares an EventSource. The connection is automatically managed, using
 // req to connect, and retrying from recoverable errors after waiting the
-// provided retry duration.
-func New(req *http.Request, retry time.Duration) *EventSource {
+// provided retry duration. Its behavior can be customised with opts.
+func New(req *http.Request, retry time.Duration, opts ...Option) *EventSource {
+	return NewWithContext(context.Background(), req, retry, opts...)
+}
+
+// NewWithContext is like New, but binds the EventSource to ctx. Cancelling ctx
+// aborts any in-flight request or reconnect wait, and any further calls to
+// Read() will return ctx.Err().
+func NewWithContext(ctx context.Context, req *http.Request, retry time.Duration, opts ...Option) *EventSource {
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Cache-Control", "no-cache")
 
-	return &EventSource{
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	es := &EventSource{
 		retry:   retry,
 		request: req,
+		client:  http.DefaultClient,
+		policy:  DefaultReconnectPolicy,
+		ctx:     ctx,
+		cancel:  cancel,
+
+		maxRedirects: 10,
+
+		onOpen:      func() {},
+		onError:     func(error, time.Duration) {},
+		onReconnect: func(int) {},
+		onClose:     func(error) {},
+		onRedirect:  func(*http.Request, []*http.Request) {},
+
+		onInvalidEvent: func(error) {},
 	}
+
+	for _, opt := range opts {
+		opt(es)
+	}
+
+	client := *es.client
+	client.CheckRedirect = es.checkRedirect(client.CheckRedirect)
+	es.client = &client
+
+	context.AfterFunc(ctx, es.closed)
+
+	return es
 }
 
-// Close the source. Any further calls to Read() will return ErrClosed.
+// ReadyState returns the current state of the connection. It may be called
+// from any goroutine.
+func (es *EventSource) ReadyState() ReadyState {
+	return ReadyState(es.state.Load())
+}
+
+func (es *EventSource) setState(s ReadyState) {
+	es.state.Store(int32(s))
+}
+
+// Close the source. Any further calls to Read() will return ErrClosed. It is
+// safe to call Close while another goroutine is blocked in Read().
 func (es *EventSource) Close() {
-	if es.r != nil {
-		es.r.Close()
+	es.cancel(ErrClosed)
+}
+
+// closed marks the source as closed and notifies the OnClose hook, once.
+func (es *EventSource) closed() {
+	es.closeOnce.Do(func() {
+		es.setState(Closed)
+		es.onClose(context.Cause(es.ctx))
+	})
+}
+
+// fail closes the source because of an unrecoverable error.
+func (es *EventSource) fail(err error) {
+	es.cancel(err)
+	es.err = context.Cause(es.ctx)
+	es.closed()
+}
+
+// interrupted reports whether either ctx or the source itself is done,
+// recording the reason if the source has been closed.
+func (es *EventSource) interrupted(ctx context.Context) bool {
+	if es.ctx.Err() != nil {
+		es.fail(context.Cause(es.ctx))
+		return true
+	}
+
+	return ctx.Err() != nil
+}
+
+// wait pauses for d, returning false if interrupted first.
+func (es *EventSource) wait(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+	case <-es.ctx.Done():
+	}
+
+	return !es.interrupted(ctx)
+}
+
+// abort cancels the request backing the current connection, unblocking any
+// pending reads from its body.
+func (es *EventSource) abort() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.connCancel != nil {
+		es.connCancel()
+	}
+}
+
+// abortOn arranges for the connection to be aborted if ctx is done before
+// the returned stop func is called. A cancellation noticed late never affects
+// a connection used after stop.
+func (es *EventSource) abortOn(ctx context.Context) (stop func()) {
+	done := false
+
+	stopAfter := context.AfterFunc(ctx, func() {
+		es.mu.Lock()
+		defer es.mu.Unlock()
+
+		if !done && es.connCancel != nil {
+			es.connCancel()
+		}
+	})
+
+	return func() {
+		stopAfter()
+
+		es.mu.Lock()
+		done = true
+		es.mu.Unlock()
+	}
+}
+
+// moveRequest returns a copy of req for a stream permanently moved to u. As
+// http.Client does when following a redirect, credentials are only kept if u
+// is on the same domain, or a subdomain of it.
+func moveRequest(req *http.Request, u *url.URL) *http.Request {
+	moved := req.Clone(req.Context())
+
+	from, to := strings.ToLower(req.URL.Hostname()), strings.ToLower(u.Hostname())
+
+	if to != from && !strings.HasSuffix(to, "."+from) {
+		for _, h := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+			moved.Header.Del(h)
+		}
+	}
+
+	moved.URL, moved.Host = u, u.Host
+	return moved
+}
+
+// checkRedirect wraps a client's redirect policy to enforce the redirect
+// limit, and remember the target of permanent redirects so that reconnects
+// go there directly.
+func (es *EventSource) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > es.maxRedirects {
+			return ErrTooManyRedirects
+		}
+
+		es.onRedirect(req, via)
+
+		// only an unbroken chain of permanent redirects from the original
+		// URL moves the stream
+		if len(via) == 1 {
+			es.moved = true
+		}
+
+		if es.moved {
+			switch req.Response.StatusCode {
+			case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+				es.permanentURL = req.URL
+			default:
+				es.moved = false
+			}
+		}
+
+		if next != nil {
+			return next(req, via)
+		}
+
+		return nil
 	}
-	es.err = ErrClosed
 }
 
 // Connect to an event source, validate the response, and gracefully handle
-// reconnects.
-func (es *EventSource) connect() {
+// reconnects. If cause is not nil, the connection is being reestablished
+// after cause, and the reconnect policy is consulted first.
+func (es *EventSource) connect(ctx context.Context, cause error) {
 	for es.err == nil {
-		if es.r != nil {
-			es.r.Close()
-			<-time.After(es.retry)
+		if cause != nil {
+			if es.r != nil {
+				es.r.Close()
+				es.r = nil
+			}
+			es.abort()
+
+			es.setState(Connecting)
+
+			es.attempt++
+			delay, ok := es.policy.Delay(es.attempt, cause, es.retry)
+
+			if !ok {
+				es.fail(&ReconnectExhaustedError{Attempts: es.attempt, Err: cause})
+				return
+			}
+
+			if err, ok := cause.(*StatusError); ok && err.RetryAfter > 0 {
+				delay = err.RetryAfter
+				if es.maxRetryAfter > 0 && delay > es.maxRetryAfter {
+					delay = es.maxRetryAfter
+				}
+			}
+
+			es.onError(cause, delay)
+
+			if !es.wait(ctx, delay) {
+				return
+			}
+
+			es.onReconnect(es.attempt)
 		}
 
-		es.request.Header.Set("Last-Event-Id", es.lastEventID)
+		if es.interrupted(ctx) {
+			return
+		}
+
+		connCtx, connCancel := context.WithCancel(es.ctx)
+
+		es.mu.Lock()
+		es.connCancel = connCancel
+		es.mu.Unlock()
 
-		resp, err := http.DefaultClient.Do(es.request)
+		req := es.request.Clone(connCtx)
+		req.Header.Set("Last-Event-Id", es.lastEventID)
+
+		var err error
+		if es.requestFunc != nil {
+			if req, err = es.requestFunc(req, es.lastEventID, es.attempt); err == nil && req == nil {
+				err = ErrNoRequest
+			}
+
+			if err != nil {
+				connCancel()
+				cause = err
+				continue
+			}
+			req = req.WithContext(connCtx)
+		}
+
+		es.permanentURL = nil
+		resp, err := es.client.Do(req)
 
 		if err != nil {
+			connCancel()
+			if es.interrupted(ctx) {
+				return
+			}
+			if errors.Is(err, ErrTooManyRedirects) {
+				es.fail(err)
+				return
+			}
+			cause = err
 			continue // reconnect
 		}
 
-		if resp.StatusCode >= 500 {
-			// assumed to be temporary, try reconnecting
-			resp.Body.Close()
-		} else if resp.StatusCode == 204 {
+		if es.permanentURL != nil {
+			es.request = moveRequest(es.request, es.permanentURL)
+		}
+
+		if resp.StatusCode == 204 {
 			resp.Body.Close()
-			es.err = ErrClosed
+			es.fail(ErrClosed)
 		} else if resp.StatusCode != 200 {
 			resp.Body.Close()
-			es.err = fmt.Errorf("endpoint returned unrecoverable status %q", resp.Status)
+
+			if err := statusError(resp); err.temporary() {
+				cause = err // try reconnecting
+			} else {
+				es.fail(err)
+			}
 		} else {
-			mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			contentType := resp.Header.Get("Content-Type")
+			mediatype, _, _ := mime.ParseMediaType(contentType)
 
 			if mediatype != "text/event-stream" {
 				resp.Body.Close()
-				es.err = fmt.Errorf("invalid content type %q", resp.Header.Get("Content-Type"))
+				es.fail(&ContentTypeError{ContentType: contentType})
 			} else {
 				es.r = resp.Body
-				es.dec = NewDecoder(es.r)
+				es.dec = NewDecoderSize(es.r, es.maxLine, es.maxEvent)
+				if es.keepExtra || es.onComment != nil {
+					es.dec.KeepExtraFields()
+				}
+				es.setState(Open)
+				es.onOpen()
 				return
 			}
 		}
+
+		connCancel()
 	}
 }
 
@@ -109,40 +495,147 @@ func (es *EventSource) connect() {
 // will not reconnect, and any further call to Read() will return the same
 // error.
 func (es *EventSource) Read() (Event, error) {
+	return es.ReadContext(context.Background())
+}
+
+// ReadContext is like Read, but returns ctx.Err() as soon as ctx is done. The
+// connection is dropped if ctx is cancelled while waiting for an event, and
+// will be reestablished from the last event ID on the next call.
+func (es *EventSource) ReadContext(ctx context.Context) (Event, error) {
+	defer es.abortOn(ctx)()
+
 	if es.r == nil {
-		es.connect()
+		es.connect(ctx, nil)
 	}
 
-	for es.err == nil {
+	for es.err == nil && ctx.Err() == nil {
 		var e Event
 
 		err := es.dec.Decode(&e)
 
-		if err == ErrInvalidEncoding {
+		if errors.Is(err, ErrInvalidEncoding) {
+			es.onInvalidEvent(err)
 			continue
 		}
 
-		if err != nil {
-			es.connect()
+		if err == ErrEventTooLarge {
+			if es.oversize == FailOversized {
+				es.fail(err)
+			} else {
+				es.onInvalidEvent(err)
+			}
 			continue
 		}
 
-		if len(e.Data) == 0 {
+		if err != nil {
+			if es.interrupted(ctx) {
+				break
+			}
+			es.connect(ctx, err)
 			continue
 		}
 
+		es.attempt = 0
+
+		if es.onComment != nil {
+			for _, f := range e.Extra {
+				if f.Name == "" {
+					es.onComment(string(f.Value))
+				}
+			}
+		}
+
+		if !es.keepExtra {
+			e.Extra = nil
+		}
+
+		// the spec applies id and retry fields even to events which are not
+		// dispatched for having no data
 		if len(e.ID) > 0 || e.ResetID {
 			es.lastEventID = e.ID
 		}
 
-		if len(e.Retry) > 0 {
-			if retry, err := strconv.Atoi(e.Retry); err == nil {
-				es.retry = time.Duration(retry) * time.Millisecond
-			}
+		if retry, ok := e.RetryDuration(); ok {
+			es.retry = retry
+		}
+
+		if len(e.Data) == 0 {
+			continue
 		}
 
 		return e, nil
 	}
 
+	if es.err == nil {
+		// the caller gave up; drop the connection so the next read
+		// reconnects cleanly
+		if es.r != nil {
+			es.r.Close()
+			es.r = nil
+			es.setState(Connecting)
+		}
+		return Event{}, ctx.Err()
+	}
+
 	return Event{}, es.err
 }
+
+// Events starts reading from the EventSource in a new goroutine, and returns a
+// channel delivering each event. The channel is closed when ctx is done or the
+// EventSource fails, after which Err reports why.
+func (es *EventSource) Events(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		for {
+			e, err := es.ReadContext(ctx)
+
+			if err == nil {
+				select {
+				case events <- e:
+					continue
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+
+			es.mu.Lock()
+			es.eventsErr = err
+			es.mu.Unlock()
+			return
+		}
+	}()
+
+	return events
+}
+
+// Err returns the error which closed the channel returned by Events, or nil
+// if it is still open.
+func (es *EventSource) Err() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	return es.eventsErr
+}
+
+// All returns an iterator over events read from the EventSource. Iteration
+// stops after yielding the first error, which is either ctx.Err() or the
+// error returned by Read().
+func (es *EventSource) All(ctx context.Context) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for {
+			e, err := es.ReadContext(ctx)
+
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
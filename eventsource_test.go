@@ -2,11 +2,14 @@ package eventsource
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -36,7 +39,7 @@ func TestEventSourceHeaders(t *testing.T) {
 	defer server.Close()
 
 	es := New(request(server.URL), -1)
-	go es.connect()
+	go es.connect(context.Background(), nil)
 
 	h := <-headers
 
@@ -57,7 +60,7 @@ func TestEventSource204(t *testing.T) {
 
 	es := New(request(server.URL), -1)
 
-	es.connect()
+	es.connect(context.Background(), nil)
 
 	if es.err == nil {
 		t.Fatal("event source did not close on 204")
@@ -72,7 +75,7 @@ func TestEventSource(t *testing.T) {
 
 	es := New(request(server.URL), time.Millisecond)
 
-	es.connect()
+	es.connect(context.Background(), nil)
 
 	if es.err == nil {
 		t.Fatal("event source did not close on 200 with no content type")
@@ -96,7 +99,7 @@ func TestEventSourceEmphemeral500(t *testing.T) {
 
 	es := New(request(server.URL), time.Millisecond)
 
-	es.connect()
+	es.connect(context.Background(), nil)
 
 	if es.err != nil {
 		t.Fatalf("event source did not reconnect on 500; got %q", es.err)
@@ -255,3 +258,711 @@ func TestEventSourceBOM(t *testing.T) {
 		t.Fatal("message was unsuccessfully decoded with BOM")
 	}
 }
+
+func TestEventSourceReadContextCancel(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Flush()
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := es.ReadContext(ctx); err != context.Canceled {
+		t.Fatalf("expected err = %v, got %v", context.Canceled, err)
+	}
+
+	if es.err != nil {
+		t.Fatalf("expected source to remain usable, got %v", es.err)
+	}
+}
+
+func TestEventSourceReadContextRetryWait(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := es.ReadContext(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected err = %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read was not interrupted during retry wait")
+	}
+}
+
+func TestEventSourceNewWithContext(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Flush()
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	es := NewWithContext(ctx, request(server.URL), -1)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := es.Read(); err != context.Canceled {
+		t.Fatalf("expected err = %v, got %v", context.Canceled, err)
+	}
+
+	if _, err := es.Read(); err != context.Canceled {
+		t.Fatalf("expected err to be sticky, got %v", err)
+	}
+}
+
+func TestEventSourceConcurrentClose(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Flush()
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+	time.AfterFunc(10*time.Millisecond, es.Close)
+
+	if _, err := es.Read(); err != ErrClosed {
+		t.Fatalf("expected err = %v, got %v", ErrClosed, err)
+	}
+}
+
+type testTransport struct {
+	requests chan *http.Request
+	http.RoundTripper
+}
+
+func (t testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests <- req
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestEventSourceWithTransport(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{Data: []byte("foo")})
+	})
+	defer server.Close()
+
+	transport := testTransport{make(chan *http.Request, 2), http.DefaultTransport}
+	es := New(request(server.URL), -1, WithTransport(transport))
+	defer es.Close()
+
+	if _, err := es.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	// force a reconnect
+	if _, err := es.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(transport.requests); n != 2 {
+		t.Fatalf("expected 2 requests through transport, got %d", n)
+	}
+}
+
+func TestEventSourceWithNilClient(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{Data: []byte("foo")})
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1, WithClient(nil))
+	defer es.Close()
+
+	if _, err := es.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventSourceReconnectPolicy(t *testing.T) {
+	var attempts []int
+
+	policy := ReconnectPolicyFunc(func(attempt int, err error, retry time.Duration) (time.Duration, bool) {
+		attempts = append(attempts, attempt)
+		return 0, attempt < 3
+	})
+
+	// nothing listens on a closed server, so every attempt fails in transport
+	server := testServer(func(w responseWriter, r *http.Request) {})
+	server.Close()
+
+	es := New(request(server.URL), time.Hour, WithReconnectPolicy(policy))
+
+	if _, err := es.Read(); err == nil {
+		t.Fatal("expected policy to give up")
+	}
+
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Fatalf("expected attempts = [1 2 3], got %v", attempts)
+	}
+}
+
+func TestEventSourceErrors(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized":
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(401)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(503)
+		}
+	})
+	defer server.Close()
+
+	es := New(request(server.URL+"/unauthorized"), -1)
+
+	var statusErr *StatusError
+	if _, err := es.Read(); !errors.As(err, &statusErr) {
+		t.Fatalf("expected StatusError, got %v", err)
+	}
+
+	if statusErr.StatusCode != 401 || statusErr.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("unexpected status error %#v", statusErr)
+	}
+
+	es = New(request(server.URL+"/html"), -1)
+
+	var contentTypeErr *ContentTypeError
+	if _, err := es.Read(); !errors.As(err, &contentTypeErr) {
+		t.Fatalf("expected ContentTypeError, got %v", err)
+	}
+
+	if contentTypeErr.ContentType != "text/html" {
+		t.Errorf("expected content type = text/html, got %q", contentTypeErr.ContentType)
+	}
+
+	es = New(request(server.URL), -1, WithReconnectPolicy(MaxAttempts(DefaultReconnectPolicy, 2)))
+
+	var exhaustedErr *ReconnectExhaustedError
+	if _, err := es.Read(); !errors.As(err, &exhaustedErr) {
+		t.Fatalf("expected ReconnectExhaustedError, got %v", err)
+	}
+
+	if exhaustedErr.Attempts != 3 {
+		t.Errorf("expected attempts = 3, got %d", exhaustedErr.Attempts)
+	}
+
+	if _, err := es.Read(); !errors.As(err, &statusErr) || statusErr.StatusCode != 503 {
+		t.Errorf("expected exhausted error to wrap 503, got %v", err)
+	}
+}
+
+func TestEventSourceLifecycle(t *testing.T) {
+	var attempts int
+	server := testServer(func(w responseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{Data: []byte("foo")})
+	})
+	defer server.Close()
+
+	var log []string
+	var closeErr = make(chan error, 1)
+
+	es := New(request(server.URL), time.Millisecond,
+		OnOpen(func() { log = append(log, "open") }),
+		OnError(func(err error, delay time.Duration) {
+			log = append(log, fmt.Sprintf("error %s %s", err, delay))
+		}),
+		OnReconnect(func(attempt int) { log = append(log, fmt.Sprintf("reconnect %d", attempt)) }),
+		OnClose(func(err error) { closeErr <- err }),
+	)
+
+	if state := es.ReadyState(); state != Connecting {
+		t.Errorf("expected state = %s, got %s", Connecting, state)
+	}
+
+	if _, err := es.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := es.ReadyState(); state != Open {
+		t.Errorf("expected state = %s, got %s", Open, state)
+	}
+
+	expected := []string{
+		`error endpoint returned status "503 Service Unavailable" 1ms`,
+		"reconnect 1",
+		"open",
+	}
+
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("expected hooks %q, got %q", expected, log)
+	}
+
+	es.Close()
+
+	select {
+	case err := <-closeErr:
+		if err != ErrClosed {
+			t.Errorf("expected close err = %v, got %v", ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnClose was not called")
+	}
+
+	if state := es.ReadyState(); state != Closed {
+		t.Errorf("expected state = %s, got %s", Closed, state)
+	}
+}
+
+func TestEventSourceEvents(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		if r.Header.Get("Last-Event-Id") == "2" {
+			w.WriteHeader(204)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+
+		enc := NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			enc.Encode(Event{ID: strconv.Itoa(i), Data: []byte("foo")})
+		}
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+
+	var ids []string
+	for e := range es.Events(context.Background()) {
+		ids = append(ids, e.ID)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"0", "1", "2"}) {
+		t.Errorf("expected ids = [0 1 2], got %v", ids)
+	}
+
+	if err := es.Err(); err != ErrClosed {
+		t.Errorf("expected err = %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestEventSourceEventsCancel(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{Data: []byte("foo")})
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := es.Events(ctx)
+
+	<-events
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed")
+	}
+
+	if err := es.Err(); err != context.Canceled {
+		t.Errorf("expected err = %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestEventSourceAll(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+
+		enc := NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			enc.Encode(Event{ID: strconv.Itoa(i), Data: []byte("foo")})
+		}
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+	defer es.Close()
+
+	var ids []string
+	for e, err := range es.All(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, e.ID)
+		if len(ids) == 4 {
+			break
+		}
+	}
+
+	// the server ignores Last-Event-Id, so a reconnect starts over
+	if !reflect.DeepEqual(ids, []string{"0", "1", "2", "0"}) {
+		t.Errorf("expected ids = [0 1 2 0], got %v", ids)
+	}
+}
+
+func TestEventSourceRetryAfter(t *testing.T) {
+	var attempts int
+	server := testServer(func(w responseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(429)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(503)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(200)
+			NewEncoder(w).Encode(Event{Data: []byte("foo")})
+		}
+	})
+	defer server.Close()
+
+	var delays []time.Duration
+	es := New(request(server.URL), time.Hour,
+		WithMaxRetryAfter(time.Millisecond),
+		OnError(func(err error, delay time.Duration) { delays = append(delays, delay) }),
+	)
+
+	if _, err := es.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(delays, []time.Duration{time.Millisecond, time.Millisecond}) {
+		t.Errorf("expected delays capped to 1ms, got %v", delays)
+	}
+}
+
+func TestEventSourceControlEvents(t *testing.T) {
+	var lastIDs []string
+	server := testServer(func(w responseWriter, r *http.Request) {
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-Id"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+
+		// id and retry apply even without data
+		fmt.Fprint(w, "retry: 5\n\nid: 7\n\ndata: message\n\n")
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1)
+	defer es.Close()
+
+	for i := 0; i < 2; i++ {
+		e, err := es.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.ID != "" || string(e.Data) != "message" {
+			t.Errorf("unexpected event %#v", e)
+		}
+	}
+
+	if es.retry != 5*time.Millisecond {
+		t.Errorf("expected retry = 5ms, got %v", es.retry)
+	}
+
+	if !reflect.DeepEqual(lastIDs, []string{"", "7"}) {
+		t.Errorf("expected reconnect with Last-Event-Id 7, got %q", lastIDs)
+	}
+}
+
+func TestEventSourceRedirects(t *testing.T) {
+	var paths []string
+	server := testServer(func(w responseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/temporary", http.StatusMovedPermanently)
+		case "/temporary":
+			http.Redirect(w, r, "/stream", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusTemporaryRedirect)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(200)
+			NewEncoder(w).Encode(Event{Data: []byte("foo")})
+		}
+	})
+	defer server.Close()
+
+	var redirects int
+	es := New(request(server.URL+"/moved"), -1, OnRedirect(func(req *http.Request, via []*http.Request) {
+		redirects++
+	}))
+	defer es.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := es.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"/moved", "/temporary", "/stream", "/temporary", "/stream"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected requests to %v, got %v", expected, paths)
+	}
+
+	if redirects != 3 {
+		t.Errorf("expected 3 redirects, got %d", redirects)
+	}
+
+	es = New(request(server.URL+"/loop"), -1, WithMaxRedirects(2))
+
+	if _, err := es.Read(); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("expected err = %v, got %v", ErrTooManyRedirects, err)
+	}
+}
+
+func TestEventSourceRedirectOtherHost(t *testing.T) {
+	var credentials []string
+	other := testServer(func(w responseWriter, r *http.Request) {
+		credentials = append(credentials, r.Header.Get("Authorization")+r.Header.Get("Cookie"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{Data: []byte("foo")})
+	})
+	defer other.Close()
+
+	server := testServer(func(w responseWriter, r *http.Request) {
+		// a different host name for the same address
+		moved := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+		http.Redirect(w, r, moved+"/stream", http.StatusMovedPermanently)
+	})
+	defer server.Close()
+
+	req := request(server.URL)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+
+	es := New(req, -1)
+	defer es.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := es.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second request reconnects to the other host directly
+	if !reflect.DeepEqual(credentials, []string{"", ""}) {
+		t.Errorf("expected no credentials sent to the other host, got %q", credentials)
+	}
+
+	if req.URL.String() != server.URL || req.Header.Get("Authorization") == "" {
+		t.Errorf("expected the original request to be left unchanged")
+	}
+}
+
+func TestEventSourceRequestFunc(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-"+r.Header.Get("Last-Event-Id") {
+			w.WriteHeader(401)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		NewEncoder(w).Encode(Event{ID: r.URL.Query().Get("next"), Data: []byte("foo")})
+	})
+	defer server.Close()
+
+	var attempts []int
+	es := New(request(server.URL), -1, WithRequestFunc(func(req *http.Request, lastEventID string, attempt int) (*http.Request, error) {
+		attempts = append(attempts, attempt)
+
+		if attempt == 1 {
+			return nil, errors.New("token unavailable")
+		}
+
+		req.Header.Set("Authorization", "Bearer token-"+lastEventID)
+		req.URL.RawQuery = "next=" + strconv.Itoa(len(attempts))
+		return req, nil
+	}))
+	defer es.Close()
+
+	for _, id := range []string{"1", "3"} {
+		e, err := es.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.ID != id {
+			t.Errorf("expected id = %s, got %s", id, e.ID)
+		}
+	}
+
+	if !reflect.DeepEqual(attempts, []int{0, 1, 2}) {
+		t.Errorf("expected attempts = [0 1 2], got %v", attempts)
+	}
+}
+
+func TestEventSourceRequestFuncNil(t *testing.T) {
+	es := New(request("http://example.invalid"), -1,
+		WithReconnectPolicy(MaxAttempts(ConstantBackoff(0), 1)),
+		WithRequestFunc(func(req *http.Request, lastEventID string, attempt int) (*http.Request, error) {
+			return nil, nil
+		}))
+	defer es.Close()
+
+	if _, err := es.Read(); !errors.Is(err, ErrNoRequest) {
+		t.Errorf("expected err = %v, got %v", ErrNoRequest, err)
+	}
+}
+
+func TestEventSourceMaxEventSize(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+
+		enc := NewEncoder(w)
+		enc.Encode(Event{Data: bytes.Repeat([]byte("a"), 1024)})
+		enc.Encode(Event{Data: []byte("small")})
+	})
+	defer server.Close()
+
+	es := New(request(server.URL), -1, WithMaxEventSize(0, 512, SkipOversized))
+	defer es.Close()
+
+	event, err := es.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(event.Data) != "small" {
+		t.Errorf("expected oversized event to be skipped, got %q", event.Data)
+	}
+
+	es = New(request(server.URL), -1, WithMaxEventSize(0, 512, FailOversized))
+
+	if _, err := es.Read(); err != ErrEventTooLarge {
+		t.Errorf("expected err = %v, got %v", ErrEventTooLarge, err)
+	}
+}
+
+func TestEventSourceOnInvalidEvent(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Write([]byte("data: \xFF\n\ndata: ok\n\n"))
+	})
+	defer server.Close()
+
+	var invalid []error
+	es := New(request(server.URL), -1, OnInvalidEvent(func(err error) {
+		invalid = append(invalid, err)
+	}))
+	defer es.Close()
+
+	event, err := es.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(event.Data) != "ok" {
+		t.Errorf("expected data = ok, got %q", event.Data)
+	}
+
+	var decodeErr *DecodeError
+	if len(invalid) != 1 || !errors.As(invalid[0], &decodeErr) || decodeErr.Pos.Line != 1 {
+		t.Errorf("expected one DecodeError at line 1, got %v", invalid)
+	}
+}
+
+func TestEventSourceOnComment(t *testing.T) {
+	server := testServer(func(w responseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(200)
+		w.Write([]byte(": keepalive\n\n: note\nx-trace: abc\ndata: ok\n\n"))
+	})
+	defer server.Close()
+
+	var comments []string
+	es := New(request(server.URL), -1, OnComment(func(text string) {
+		comments = append(comments, text)
+	}))
+	defer es.Close()
+
+	event, err := es.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(comments, []string{"keepalive", "note"}) {
+		t.Errorf("expected comments [keepalive note], got %q", comments)
+	}
+
+	if event.Extra != nil {
+		t.Errorf("expected no extra fields without WithExtraFields, got %q", event.Extra)
+	}
+
+	es = New(request(server.URL), -1, WithExtraFields())
+	defer es.Close()
+
+	if event, err = es.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(event.Extra) != 2 || event.Extra[1].Name != "x-trace" {
+		t.Errorf("unexpected extra fields %q", event.Extra)
+	}
+}
+
+func TestEventRetryDuration(t *testing.T) {
+	table := []struct {
+		retry string
+		d     time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"1500", 1500 * time.Millisecond, true},
+		{"-5", 0, false},
+		{"+10", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+
+	for i, tt := range table {
+		d, ok := Event{Retry: tt.retry}.RetryDuration()
+
+		if d != tt.d || ok != tt.ok {
+			t.Errorf("%d. expected RetryDuration(%q) = %s, %t, got %s, %t", i, tt.retry, tt.d, tt.ok, d, ok)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package eventsource_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/bernerdschaefer/eventsource"
 	"io"
@@ -46,6 +47,34 @@ func ExampleHandler_ServeHTTP() {
 	})
 }
 
+func ExampleStreamHandler() {
+	http.Handle("/events", eventsource.StreamHandler(func(ctx context.Context, r *http.Request, e *eventsource.Encoder) error {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Encode(eventsource.Event{Data: []byte("tick")}); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}))
+}
+
+func ExampleHub() {
+	hub := eventsource.NewHub()
+
+	http.Handle("/events", hub.Handler(func(r *http.Request) []string {
+		return r.URL.Query()["topic"]
+	}))
+
+	hub.Publish("prices", eventsource.Event{Type: "update", Data: []byte("42")})
+}
+
 func ExampleEncoder() {
 	enc := eventsource.NewEncoder(os.Stdout)
 
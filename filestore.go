@@ -0,0 +1,631 @@
+package eventsource
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SyncPolicy decides when a FileStore flushes appended events to stable
+// storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs after every append.
+	SyncAlways SyncPolicy = iota
+
+	// SyncInterval syncs at most an interval after an append, so that a
+	// crash loses at most that much history.
+	SyncInterval
+
+	// SyncNever leaves syncing to the operating system.
+	SyncNever
+)
+
+const (
+	// indexInterval is the number of records between the entries of a
+	// segment's index.
+	indexInterval = 64
+
+	// maxRecordSize bounds the size of a record, so that a corrupt header
+	// can't cause a huge allocation when it is read.
+	maxRecordSize = 64 << 20
+
+	segmentSuffix = ".log"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A FileStore is a Store which appends events to a log of segment files in a
+// directory, so that they can be replayed after a restart. Segments are
+// discarded whole, oldest first, once the log exceeds its retention limits.
+// Its index is rebuilt from the log when it is opened. It is safe for
+// concurrent use.
+type FileStore struct {
+	mu       sync.Mutex
+	dir      string
+	segments []*segment // oldest first; the last is being appended to
+	f        *os.File   // the last segment
+	buf      []byte     // reused by Append
+	last     uint64
+	closed   bool
+	err      error // from a background sync
+
+	segmentSize int64
+	maxSize     int64
+	maxAge      time.Duration
+	sync        SyncPolicy
+	interval    time.Duration
+	timer       *time.Timer
+
+	now func() time.Time
+}
+
+type segment struct {
+	path        string
+	first, last uint64 // last is first-1 while the segment is empty
+	size        int64
+	newest      time.Time
+	index       []int64 // offsets of records first, first+indexInterval, ...
+}
+
+// A FileStoreOption configures a FileStore.
+type FileStoreOption func(*FileStore)
+
+// WithSegmentSize sets the size past which a new segment is started. The
+// default is 4 MiB.
+func WithSegmentSize(n int64) FileStoreOption {
+	return func(s *FileStore) {
+		s.segmentSize = n
+	}
+}
+
+// WithRetention discards the oldest segments while the log is larger than
+// maxSize bytes, or their newest event is older than maxAge. Events older than
+// maxAge are never replayed. A zero value for either leaves that limit off;
+// the segment being appended to is always kept.
+func WithRetention(maxSize int64, maxAge time.Duration) FileStoreOption {
+	return func(s *FileStore) {
+		s.maxSize, s.maxAge = maxSize, maxAge
+	}
+}
+
+// WithSyncPolicy sets when appended events are synced to stable storage. The
+// interval is used by SyncInterval. The default is SyncInterval, with an
+// interval of one second.
+func WithSyncPolicy(p SyncPolicy, interval time.Duration) FileStoreOption {
+	return func(s *FileStore) {
+		s.sync, s.interval = p, interval
+	}
+}
+
+// OpenFileStore opens the log in dir, creating it if needed, and continues
+// assigning IDs from its last event. The final segment is truncated at its
+// first bad record, which a crash can leave partly written or zero-filled;
+// damage to any other segment is reported with a CorruptLogError.
+func OpenFileStore(dir string, opts ...FileStoreOption) (*FileStore, error) {
+	s := &FileStore{
+		dir:         dir,
+		segmentSize: 4 << 20,
+		sync:        SyncInterval,
+		interval:    time.Second,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// names are zero-padded, so sorted by name is sorted by ID
+	for _, entry := range entries {
+		name := entry.Name()
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+
+		if !strings.HasSuffix(name, segmentSuffix) || err != nil {
+			continue
+		}
+
+		s.segments = append(s.segments, &segment{
+			path:  filepath.Join(dir, name),
+			first: first,
+			last:  first - 1,
+		})
+	}
+
+	for i, seg := range s.segments {
+		if err := seg.load(i == len(s.segments)-1); err != nil {
+			return nil, err
+		}
+
+		if i > 0 && seg.first != s.last+1 {
+			return nil, &CorruptLogError{Path: seg.path}
+		}
+
+		s.last = seg.last
+	}
+
+	if len(s.segments) == 0 {
+		if err := s.create(1); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	seg := s.segments[len(s.segments)-1]
+
+	if s.f, err = os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		return nil, err
+	}
+
+	s.expire()
+	return s, nil
+}
+
+// load reads the segment's records to build its index. In the final segment,
+// everything from the first bad record on is taken to be torn by a crash, and
+// discarded.
+func (seg *segment) load(final bool) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for {
+		rec, n, err := readRecord(r)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil || rec.seq != seg.last+1 {
+			if final {
+				return f.Truncate(seg.size)
+			}
+
+			return &CorruptLogError{Path: seg.path, Offset: seg.size}
+		}
+
+		seg.add(rec, n)
+	}
+}
+
+// add updates the segment for a record of n bytes appended at its end.
+func (seg *segment) add(rec record, n int) {
+	if (rec.seq-seg.first)%indexInterval == 0 {
+		seg.index = append(seg.index, seg.size)
+	}
+
+	seg.last = rec.seq
+	seg.size += int64(n)
+	seg.newest = rec.at
+}
+
+// create starts a new segment, whose first event will have ID first.
+func (s *FileStore) create(first uint64) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", first, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		if err := s.f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+
+		s.f.Close()
+	}
+
+	s.f = f
+	s.segments = append(s.segments, &segment{path: path, first: first, last: first - 1})
+	return nil
+}
+
+// Append writes e to the log as published to topic, and returns it with its
+// ID set to the next in sequence. IDs are decimal integers, counting up from
+// 1. An event too large to be read back, at over 64 MiB, is not written, and
+// ErrEventTooLarge is returned.
+func (s *FileStore) Append(topic string, e Event) (Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return e, ErrClosed
+	}
+
+	if err := s.err; err != nil {
+		s.err = nil
+		return e, err
+	}
+
+	rec := record{seq: s.last + 1, topic: topic, at: s.now(), event: e}
+	rec.event.ID, rec.event.ResetID = strconv.FormatUint(rec.seq, 10), false
+	s.buf = appendRecord(s.buf[:0], rec)
+
+	if len(s.buf) > maxRecordSize {
+		s.buf = nil
+		return e, ErrEventTooLarge
+	}
+
+	seg := s.segments[len(s.segments)-1]
+
+	if seg.size > 0 && seg.size+int64(len(s.buf)) > s.segmentSize {
+		if err := s.create(rec.seq); err != nil {
+			return e, err
+		}
+
+		seg = s.segments[len(s.segments)-1]
+	}
+
+	if _, err := s.f.Write(s.buf); err != nil {
+		// drop whatever part of the record was written
+		s.f.Truncate(seg.size)
+		return e, err
+	}
+
+	seg.add(rec, len(s.buf))
+	s.last = rec.seq
+
+	if cap(s.buf) > maxBufferSize {
+		s.buf = nil
+	}
+
+	switch s.sync {
+	case SyncAlways:
+		if err := s.f.Sync(); err != nil {
+			return e, err
+		}
+	case SyncInterval:
+		if s.timer == nil {
+			s.timer = time.AfterFunc(s.interval, s.syncLater)
+		}
+	}
+
+	s.expire()
+	return rec.event, nil
+}
+
+// LastID returns the ID of the last event in the log, or "" if it is empty.
+func (s *FileStore) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return formatID(s.last)
+}
+
+// syncLater syncs the segment being appended to, for SyncInterval.
+func (s *FileStore) syncLater() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timer = nil
+
+	if !s.closed {
+		if err := s.f.Sync(); err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+}
+
+// expire removes the segments beyond the store's retention limits. It must be
+// called with s.mu held.
+func (s *FileStore) expire() {
+	var size int64
+
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	cutoff := s.now().Add(-s.maxAge)
+
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+
+		if !(s.maxSize > 0 && size > s.maxSize) && !(s.maxAge > 0 && seg.newest.Before(cutoff)) {
+			return
+		}
+
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+
+		size -= seg.size
+		s.segments[0] = nil
+		s.segments = s.segments[1:]
+	}
+}
+
+// Since returns the events published to any of topics after the one with ID
+// lastID that are still in the log, oldest first. If lastID is empty, or was
+// not assigned by the store, nil is returned.
+func (s *FileStore) Since(lastID string, topics ...string) ([]Event, error) {
+	seq, err := strconv.ParseUint(lastID, 10, 64)
+
+	if err != nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	s.expire()
+
+	cutoff := s.now().Add(-s.maxAge)
+
+	i := sort.Search(len(s.segments), func(i int) bool {
+		return s.segments[i].last > seq
+	})
+
+	var events []Event
+
+	for _, seg := range s.segments[i:] {
+		if seg.last < seg.first {
+			continue
+		}
+
+		var offset int64
+
+		if seq >= seg.first {
+			offset = seg.index[(seq+1-seg.first)/indexInterval]
+		}
+
+		err := seg.scan(offset, func(rec record) {
+			if rec.seq <= seq || (s.maxAge > 0 && rec.at.Before(cutoff)) {
+				return
+			}
+
+			if slices.Contains(topics, rec.topic) {
+				events = append(events, rec.event)
+			}
+		})
+
+		if err != nil {
+			return events, err
+		}
+	}
+
+	return events, nil
+}
+
+// scan calls f for each of the segment's records from offset.
+func (seg *segment) scan(offset int64, f func(record)) error {
+	file, err := os.Open(seg.path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(file, offset, seg.size-offset))
+
+	for {
+		rec, n, err := readRecord(r)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return &CorruptLogError{Path: seg.path, Offset: offset}
+		}
+
+		f(rec)
+		offset += int64(n)
+	}
+}
+
+// Close syncs and closes the log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.closed = true
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	err := s.f.Sync()
+
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// appendRecord appends rec to buf as it is written to the log: the length of
+// the body and its checksum, followed by the body.
+func appendRecord(buf []byte, rec record) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, 8)...)
+
+	buf = binary.AppendUvarint(buf, rec.seq)
+	buf = binary.AppendVarint(buf, rec.at.UnixNano())
+	buf = appendString(buf, rec.topic)
+	buf = appendString(buf, rec.event.Type)
+	buf = appendString(buf, rec.event.Retry)
+	buf = appendBytes(buf, rec.event.Data)
+	buf = binary.AppendUvarint(buf, uint64(len(rec.event.Extra)))
+
+	for _, f := range rec.event.Extra {
+		buf = appendString(buf, f.Name)
+		buf = appendBytes(buf, f.Value)
+	}
+
+	body := buf[start+8:]
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(buf[start+4:], crc32.Checksum(body, crcTable))
+
+	return buf
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+var errBadRecord = errors.New("bad record")
+
+// readRecord reads a record written by appendRecord, returning its size in
+// the log. It returns io.EOF at the end of the log, and io.ErrUnexpectedEOF
+// if the record is cut short.
+func readRecord(r *bufio.Reader) (record, int, error) {
+	var header [8]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return record{}, 0, err
+	}
+
+	n := binary.LittleEndian.Uint32(header[:])
+
+	if n > maxRecordSize {
+		return record{}, 0, errBadRecord
+	}
+
+	body := make([]byte, n)
+
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return record{}, 0, err
+	}
+
+	if crc32.Checksum(body, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return record{}, 0, errBadRecord
+	}
+
+	rec, ok := parseRecord(body)
+
+	if !ok {
+		return record{}, 0, errBadRecord
+	}
+
+	return rec, len(header) + len(body), nil
+}
+
+// parseRecord parses the body of a record. Byte slices in the event share
+// body's memory.
+func parseRecord(body []byte) (rec record, ok bool) {
+	seq, n := binary.Uvarint(body)
+
+	if n <= 0 {
+		return rec, false
+	}
+
+	body = body[n:]
+	at, n := binary.Varint(body)
+
+	if n <= 0 {
+		return rec, false
+	}
+
+	body = body[n:]
+
+	var topic, typ, retry, data []byte
+
+	for _, b := range []*[]byte{&topic, &typ, &retry, &data} {
+		if *b, body, ok = readBytes(body); !ok {
+			return rec, false
+		}
+	}
+
+	extra, n := binary.Uvarint(body)
+
+	if n <= 0 || extra > uint64(len(body)) {
+		return rec, false
+	}
+
+	body = body[n:]
+
+	rec = record{
+		seq:   seq,
+		topic: string(topic),
+		at:    time.Unix(0, at),
+		event: Event{
+			ID:    strconv.FormatUint(seq, 10),
+			Type:  string(typ),
+			Retry: string(retry),
+			Data:  data,
+		},
+	}
+
+	for ; extra > 0; extra-- {
+		var name, value []byte
+
+		if name, body, ok = readBytes(body); !ok {
+			return rec, false
+		}
+
+		if value, body, ok = readBytes(body); !ok {
+			return rec, false
+		}
+
+		rec.event.Extra = append(rec.event.Extra, Field{string(name), value})
+	}
+
+	return rec, len(body) == 0
+}
+
+// readBytes reads a length-prefixed byte slice from the start of buf, and
+// returns it with the rest of buf. An empty slice is returned as nil.
+func readBytes(buf []byte) (b, rest []byte, ok bool) {
+	n, size := binary.Uvarint(buf)
+
+	if size <= 0 || n > uint64(len(buf)-size) {
+		return nil, nil, false
+	}
+
+	buf = buf[size:]
+
+	if n == 0 {
+		return nil, buf, true
+	}
+
+	return buf[:n:n], buf[n:], true
+}
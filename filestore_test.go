@@ -0,0 +1,282 @@
+package eventsource
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func openFileStore(t *testing.T, dir string, opts ...FileStoreOption) *FileStore {
+	s, err := OpenFileStore(dir, opts...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir, WithSyncPolicy(SyncAlways, 0))
+
+	published := Event{
+		Type:  "update",
+		Retry: "1000",
+		Data:  []byte("a\nb"),
+		Extra: []Field{{"", []byte("comment")}, {"custom", nil}},
+	}
+
+	s.Append("a", published)
+	s.Append("b", Event{Data: []byte("b")})
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openFileStore(t, dir)
+	defer s.Close()
+
+	e, err := s.Append("a", Event{ID: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.ID != "3" {
+		t.Errorf("expected id = 3, got %q", e.ID)
+	}
+
+	events, err := s.Since("0", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published.ID = "1"
+	expected := []Event{published, {ID: "3"}}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %#v, got %#v", expected, events)
+	}
+}
+
+func TestFileStoreSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir, WithSegmentSize(1024), WithSyncPolicy(SyncNever, 0))
+
+	for i := 0; i < 500; i++ {
+		s.Append(strconv.Itoa(i%2), Event{Data: []byte("some data")})
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(matches) < 2 {
+		t.Fatalf("expected several segments, got %d", len(matches))
+	}
+
+	for _, lastID := range []int{0, 1, 63, 64, 65, 250, 498, 499} {
+		ids := since(t, s, strconv.Itoa(lastID), "1")
+
+		// topic 1 has the even IDs
+		if exp := 250 - lastID/2; len(ids) != exp {
+			t.Errorf("%d. expected %d events, got %d", lastID, exp, len(ids))
+			continue
+		}
+
+		if first := lastID + 2 - lastID%2; len(ids) > 0 && ids[0] != strconv.Itoa(first) {
+			t.Errorf("%d. expected events from %d, got %s", lastID, first, ids[0])
+		}
+	}
+
+	if ids := since(t, s, "500", "0", "1"); len(ids) != 0 {
+		t.Errorf("expected no events, got %v", ids)
+	}
+
+	s.Close()
+
+	// retention is applied when the log is reopened
+	s = openFileStore(t, dir, WithSegmentSize(1024), WithRetention(2048, 0))
+	defer s.Close()
+
+	matches, _ = filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(matches) > 3 {
+		t.Errorf("expected old segments to be removed, got %d", len(matches))
+	}
+
+	ids := since(t, s, "0", "0", "1")
+
+	if len(ids) == 0 || len(ids) == 500 || ids[len(ids)-1] != "500" {
+		t.Errorf("expected only the newest events, got %d ending %v", len(ids), ids[len(ids)-1:])
+	}
+}
+
+func TestFileStoreMaxAge(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	s := openFileStore(t, t.TempDir(), WithSegmentSize(1), WithRetention(0, time.Minute))
+	s.now = func() time.Time { return now }
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		s.Append("a", Event{})
+		now = now.Add(20 * time.Second)
+	}
+
+	now = now.Add(15 * time.Second)
+
+	if ids := since(t, s, "0", "a"); len(ids) != 2 || ids[0] != "4" {
+		t.Errorf("expected events from the last minute, got %v", ids)
+	}
+
+	if len(s.segments) != 2 {
+		t.Errorf("expected expired segments to be removed, got %d", len(s.segments))
+	}
+}
+
+func TestFileStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir)
+
+	for i := 0; i < 3; i++ {
+		s.Append("a", Event{Data: []byte("data")})
+	}
+
+	s.Close()
+
+	path := filepath.Join(dir, "00000000000000000001.log")
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a record cut short by a crash is discarded
+	os.WriteFile(path, log[:len(log)-3], 0o644)
+
+	s = openFileStore(t, dir)
+
+	if e, _ := s.Append("a", Event{}); e.ID != "3" {
+		t.Errorf("expected id = 3, got %q", e.ID)
+	}
+
+	if ids := since(t, s, "0", "a"); len(ids) != 3 {
+		t.Errorf("expected 3 events, got %v", ids)
+	}
+
+	s.Close()
+}
+
+func TestFileStoreRecoveryZeroFilled(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir)
+	s.Append("a", Event{Data: []byte("data")})
+	s.Close()
+
+	// a crash can leave the end of the file zero-filled
+	path := filepath.Join(dir, "00000000000000000001.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Write(make([]byte, 4096))
+	f.Close()
+
+	s = openFileStore(t, dir)
+	defer s.Close()
+
+	if e, _ := s.Append("a", Event{}); e.ID != "2" {
+		t.Errorf("expected id = 2, got %q", e.ID)
+	}
+
+	if ids := since(t, s, "0", "a"); len(ids) != 2 {
+		t.Errorf("expected 2 events, got %v", ids)
+	}
+}
+
+func TestFileStoreCorruption(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir, WithSegmentSize(1))
+
+	for i := 0; i < 3; i++ {
+		s.Append("a", Event{Data: []byte("data")})
+	}
+
+	s.Close()
+
+	// damage to a segment before the last is reported
+	path := filepath.Join(dir, "00000000000000000002.log")
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log[len(log)/2] ^= 0xFF
+	os.WriteFile(path, log, 0o644)
+
+	var corrupt *CorruptLogError
+	if _, err := OpenFileStore(dir); !errors.As(err, &corrupt) {
+		t.Fatalf("expected CorruptLogError, got %v", err)
+	}
+
+	if corrupt.Path != path || corrupt.Offset != 0 {
+		t.Errorf("unexpected error details %#v", corrupt)
+	}
+}
+
+func TestFileStoreMaxRecordSize(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir)
+
+	if _, err := s.Append("a", Event{Data: make([]byte, maxRecordSize)}); err != ErrEventTooLarge {
+		t.Errorf("expected err = %v, got %v", ErrEventTooLarge, err)
+	}
+
+	if e, err := s.Append("a", Event{}); err != nil || e.ID != "1" {
+		t.Errorf("expected id = 1, got %q (err = %v)", e.ID, err)
+	}
+
+	s.Close()
+
+	// the log can still be opened
+	s = openFileStore(t, dir)
+	defer s.Close()
+
+	if ids := since(t, s, "0", "a"); len(ids) != 1 {
+		t.Errorf("expected 1 event, got %v", ids)
+	}
+}
+
+func TestHubFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store := openFileStore(t, dir)
+
+	hub := NewHub(WithStore(store))
+	hub.Publish("a", Event{Data: []byte("1")})
+	hub.Publish("a", Event{Data: []byte("2")})
+	hub.Close()
+	store.Close()
+
+	// after a restart, a client resumes from the log
+	store = openFileStore(t, dir)
+	defer store.Close()
+
+	hub = NewHub(WithStore(store))
+	defer hub.Close()
+
+	s, missed, err := hub.Resume("1", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missed) != 1 || string(missed[0].Data) != "2" {
+		t.Errorf("expected missed event 2, got %#v", missed)
+	}
+
+	hub.Publish("a", Event{})
+
+	if e := receive(t, s); e.ID != "3" {
+		t.Errorf("expected live event 3, got %q", e.ID)
+	}
+}
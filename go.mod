@@ -0,0 +1,3 @@
+module github.com/bernerdschaefer/eventsource
+
+go 1.23
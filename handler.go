@@ -1,18 +1,29 @@
 package eventsource
 
 import (
+	"context"
 	"mime"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Handler is an adapter for ordinary functions to act as an HTTP handler for
 // event sources. It receives the ID of the last event processed by the client,
 // and Encoder to deliver messages, and a channel to be notified if the client
 // connection is closed.
+//
+// Handler is kept for compatibility; new code should use StreamHandler.
 type Handler func(lastId string, encoder *Encoder, stop <-chan bool)
 
-func (h Handler) acceptable(accept string) bool {
+// A StreamHandler serves an event stream. ctx is the request's context, which
+// is cancelled when the client disconnects or the server shuts down, and enc
+// writes events to the client. If the handler returns an error while the
+// client is still connected, the response is aborted, so that the client sees
+// a failed connection rather than the end of the stream.
+type StreamHandler func(ctx context.Context, r *http.Request, enc *Encoder) error
+
+func acceptable(accept string) bool {
 	if accept == "" {
 		// The absense of an Accept header is equivalent to "*/*".
 		// https://tools.ietf.org/html/rfc2296#section-4.2.2
@@ -33,25 +44,122 @@ func (h Handler) acceptable(accept string) bool {
 	return false
 }
 
-// ServeHTTP calls h with an Encoder and a close notification channel. It
-// performs Content-Type negotiation.
-func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (h Handler) acceptable(accept string) bool {
+	return acceptable(accept)
+}
+
+// responseFlusher flushes a response through http.ResponseController, which
+// finds the Flush method of writers wrapped by middleware.
+type responseFlusher struct {
+	http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (f responseFlusher) Flush() {
+	f.rc.Flush()
+}
+
+// startStream performs Content-Type negotiation, and writes the response
+// headers for an event stream. It returns an encoder for the stream, or nil if
+// the client does not accept one.
+func startStream(w http.ResponseWriter, r *http.Request) *Encoder {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Vary", "Accept")
 
-	if !h.acceptable(r.Header.Get("Accept")) {
+	if !acceptable(r.Header.Get("Accept")) {
 		w.WriteHeader(http.StatusNotAcceptable)
-		return
+		return nil
 	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.WriteHeader(http.StatusOK)
 
-	var stop <-chan bool
+	return NewEncoder(responseFlusher{w, http.NewResponseController(w)})
+}
+
+// ServeHTTP calls h with the request's context and an Encoder. It performs
+// Content-Type negotiation.
+func (h StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	enc := startStream(w, r)
+
+	if enc == nil {
+		return
+	}
+
+	if err := h(r.Context(), r, enc); err != nil && r.Context().Err() == nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Heartbeat returns a handler which calls h, and meanwhile writes a comment to
+// the stream whenever no event has been written for interval, so that proxies
+// and load balancers don't close the connection as idle. If interval is not
+// positive, h is returned unchanged.
+func (h StreamHandler) Heartbeat(interval time.Duration) StreamHandler {
+	if interval <= 0 {
+		return h
+	}
+
+	return func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			enc.keepAlive(ctx, interval)
+		}()
+
+		// the response can't be written once the handler returns
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		return h(ctx, r, enc)
+	}
+}
+
+// ServeHTTP calls h with an Encoder and a close notification channel. It
+// performs Content-Type negotiation.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, 0)
+}
+
+// Heartbeat returns an HTTP handler which serves h like ServeHTTP, and writes
+// keepalive comments as described for StreamHandler.Heartbeat.
+func (h Handler) Heartbeat(interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, interval)
+	})
+}
+
+func (h Handler) serve(w http.ResponseWriter, r *http.Request, heartbeat time.Duration) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
 
 	if notifier, ok := w.(http.CloseNotifier); ok {
-		stop = notifier.CloseNotify()
+		closed := notifier.CloseNotify()
+
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	stream := StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		stop := make(chan bool, 1)
+		defer context.AfterFunc(ctx, func() { stop <- true })()
+
+		h(r.Header.Get("Last-Event-Id"), enc, stop)
+		return nil
+	})
+
+	if heartbeat > 0 {
+		stream = stream.Heartbeat(heartbeat)
 	}
 
-	h(r.Header.Get("Last-Event-Id"), NewEncoder(w), stop)
+	stream.ServeHTTP(w, r.WithContext(ctx))
 }
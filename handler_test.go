@@ -1,6 +1,9 @@
 package eventsource
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -111,3 +114,183 @@ func TestHandlerCloseNotify(t *testing.T) {
 		t.Error("handler was not notified of close")
 	}
 }
+
+func TestStreamHandler(t *testing.T) {
+	handler := StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		return enc.Encode(Event{ID: r.Header.Get("Last-Event-Id"), Data: []byte("hello")})
+	})
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-Id", "1")
+
+	handler.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Type") != "text/event-stream" || w.Code != http.StatusOK {
+		t.Fatal("handler did not start an event stream")
+	}
+
+	var event Event
+	NewDecoder(w.Body).Decode(&event)
+
+	if !reflect.DeepEqual(event, Event{Type: "message", ID: "1", Data: []byte("hello")}) {
+		t.Errorf("unexpected handler output %#v", event)
+	}
+}
+
+func TestStreamHandlerDisconnect(t *testing.T) {
+	done := make(chan error, 1)
+	server := httptest.NewServer(StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		enc.Encode(Event{Data: []byte("hello")})
+		<-ctx.Done()
+		done <- ctx.Err()
+		return nil
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event Event
+	NewDecoder(resp.Body).Decode(&event)
+	resp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled on disconnect")
+	}
+}
+
+func TestStreamHandlerError(t *testing.T) {
+	server := httptest.NewServer(StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		enc.Encode(Event{Data: []byte("hello")})
+		return errors.New("failed")
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected the response to be aborted")
+	}
+}
+
+// hiddenWriter hides the optional interfaces of a ResponseWriter, as some
+// middleware does, but allows them to be found with Unwrap.
+type hiddenWriter struct {
+	w http.ResponseWriter
+}
+
+func (h hiddenWriter) Header() http.Header         { return h.w.Header() }
+func (h hiddenWriter) Write(p []byte) (int, error) { return h.w.Write(p) }
+func (h hiddenWriter) WriteHeader(code int)        { h.w.WriteHeader(code) }
+func (h hiddenWriter) Unwrap() http.ResponseWriter { return h.w }
+
+func TestHandlerStopWithoutCloseNotifier(t *testing.T) {
+	done := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Handler(func(lastID string, enc *Encoder, stop <-chan bool) {
+			enc.Encode(Event{Data: []byte("hello")})
+			<-stop
+			done <- true
+		}).ServeHTTP(hiddenWriter{w}, r)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the event arriving shows the encoder flushed through the wrapper
+	var event Event
+	if err := NewDecoder(resp.Body).Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not notified of close")
+	}
+}
+
+func TestStreamHandlerHeartbeat(t *testing.T) {
+	events := make(chan Event)
+	server := httptest.NewServer(StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		for {
+			select {
+			case e := <-events:
+				enc.Encode(e)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}).Heartbeat(10 * time.Millisecond))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	dec := NewDecoder(resp.Body)
+	dec.KeepExtraFields()
+
+	heartbeat := func(e Event) bool {
+		return reflect.DeepEqual(e.Extra, []Field{{"", []byte{}}}) && e.Data == nil
+	}
+
+	// a heartbeat arrives while idle
+	var event Event
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if !heartbeat(event) {
+		t.Fatalf("expected a heartbeat comment, got %#v", event)
+	}
+
+	// events are delivered whole between heartbeats
+	for i := 0; i < 5; i++ {
+		events <- Event{Data: []byte("tick")}
+
+		for {
+			if err := dec.Decode(&event); err != nil {
+				t.Fatal(err)
+			}
+
+			if !heartbeat(event) {
+				break
+			}
+		}
+
+		if event.Extra != nil || string(event.Data) != "tick" {
+			t.Fatalf("unexpected event %#v", event)
+		}
+	}
+}
+
+func TestStreamHandlerHeartbeatDisabled(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+
+		StreamHandler(func(ctx context.Context, r *http.Request, enc *Encoder) error {
+			time.Sleep(5 * time.Millisecond)
+			return enc.Encode(Event{Data: []byte("tick")})
+		}).Heartbeat(interval).ServeHTTP(w, r)
+
+		if exp := "data: tick\n\n"; w.Body.String() != exp {
+			t.Errorf("%v. expected %q, got %q", interval, exp, w.Body.String())
+		}
+	}
+}
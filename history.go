@@ -0,0 +1,121 @@
+package eventsource
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A History records recently published events, so that clients reconnecting
+// with a Last-Event-Id can be sent the events they missed. It assigns each
+// event its ID. It is safe for concurrent use.
+type History struct {
+	mu      sync.Mutex
+	max     int
+	maxAge  time.Duration
+	records []record // oldest first
+	last    uint64
+	now     func() time.Time
+}
+
+type record struct {
+	seq   uint64
+	topic string
+	at    time.Time
+	event Event
+}
+
+// NewHistory returns a history retaining at most max events, none of them
+// older than maxAge. A zero value for either leaves that limit off.
+func NewHistory(max int, maxAge time.Duration) *History {
+	return &History{max: max, maxAge: maxAge, now: time.Now}
+}
+
+// Append records e as published to topic, and returns it with its ID set to
+// the next in sequence. IDs are decimal integers, counting up from 1. It
+// never returns an error.
+func (h *History) Append(topic string, e Event) (Event, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.last++
+	e.ID, e.ResetID = strconv.FormatUint(h.last, 10), false
+
+	h.records = append(h.records, record{h.last, topic, h.now(), e})
+	h.expire()
+
+	return e, nil
+}
+
+// LastID returns the ID of the last event appended, or "" if there is none.
+func (h *History) LastID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return formatID(h.last)
+}
+
+// formatID formats a sequence number as an event ID; zero, for no event, is
+// empty.
+func formatID(seq uint64) string {
+	if seq == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(seq, 10)
+}
+
+// expire discards the records beyond the history's limits. It must be called
+// with h.mu held.
+func (h *History) expire() {
+	n := 0
+
+	if h.max > 0 && len(h.records) > h.max {
+		n = len(h.records) - h.max
+	}
+
+	if h.maxAge > 0 {
+		cutoff := h.now().Add(-h.maxAge)
+
+		for n < len(h.records) && h.records[n].at.Before(cutoff) {
+			n++
+		}
+	}
+
+	// release the discarded events before appends reallocate the records
+	clear(h.records[:n])
+	h.records = h.records[n:]
+}
+
+// Since returns the retained events published to any of topics after the one
+// with ID lastID, oldest first. It never returns an error. If lastID is empty,
+// or was not assigned by the history, nil is returned. If some of the events
+// after lastID have already been discarded, only the rest are returned.
+func (h *History) Since(lastID string, topics ...string) ([]Event, error) {
+	seq, err := strconv.ParseUint(lastID, 10, 64)
+
+	if err != nil {
+		return nil, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.expire()
+
+	i := sort.Search(len(h.records), func(i int) bool {
+		return h.records[i].seq > seq
+	})
+
+	var events []Event
+
+	for _, r := range h.records[i:] {
+		if slices.Contains(topics, r.topic) {
+			events = append(events, r.event)
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,90 @@
+package eventsource
+
+import (
+	"testing"
+	"time"
+)
+
+func eventIDs(events []Event) []string {
+	var ids []string
+
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func since(t *testing.T, s Store, lastID string, topics ...string) []string {
+	events, err := s.Since(lastID, topics...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return eventIDs(events)
+}
+
+func TestHistorySince(t *testing.T) {
+	h := NewHistory(0, 0)
+
+	for _, topic := range []string{"a", "b", "a", "c"} {
+		h.Append(topic, Event{ID: "ignored", Data: []byte(topic)})
+	}
+
+	table := []struct {
+		lastID string
+		topics []string
+		ids    []string
+	}{
+		{"", []string{"a"}, nil},
+		{"x", []string{"a"}, nil},
+		{"0", []string{"a", "b", "c"}, []string{"1", "2", "3", "4"}},
+		{"1", []string{"a"}, []string{"3"}},
+		{"1", []string{"b", "c"}, []string{"2", "4"}},
+		{"4", []string{"a", "b", "c"}, nil},
+		{"9", []string{"a"}, nil},
+	}
+
+	for i, tt := range table {
+		ids := since(t, h, tt.lastID, tt.topics...)
+
+		if len(ids) != len(tt.ids) {
+			t.Errorf("%d. expected ids %v, got %v", i, tt.ids, ids)
+			continue
+		}
+
+		for j := range ids {
+			if ids[j] != tt.ids[j] {
+				t.Errorf("%d. expected ids %v, got %v", i, tt.ids, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	h := NewHistory(3, time.Minute)
+	h.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		h.Append("a", Event{})
+		now = now.Add(20 * time.Second)
+	}
+
+	if ids := since(t, h, "0", "a"); len(ids) != 3 || ids[0] != "3" {
+		t.Errorf("expected the last 3 events, got %v", ids)
+	}
+
+	now = now.Add(15 * time.Second)
+
+	if ids := since(t, h, "0", "a"); len(ids) != 2 || ids[0] != "4" {
+		t.Errorf("expected events from the last minute, got %v", ids)
+	}
+
+	if e, _ := h.Append("a", Event{}); e.ID != "6" {
+		t.Errorf("expected id = 6, got %q", e.ID)
+	}
+}
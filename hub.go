@@ -0,0 +1,304 @@
+package eventsource
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	// subscriptionBuffer is the number of events a subscription may fall
+	// behind before it is dropped.
+	subscriptionBuffer = 64
+
+	// defaultMaxReplay is the default limit on the events a resume replays.
+	defaultMaxReplay = 1000
+)
+
+// A Hub fans events out to many subscribers, by topic. It is safe for
+// concurrent use.
+type Hub struct {
+	mu        sync.Mutex
+	topics    map[string]map[*Subscription]struct{}
+	closed    bool
+	store     Store
+	maxReplay int
+}
+
+// A Store records the events published on a Hub, assigning their IDs, so that
+// they can be replayed to clients resuming from a Last-Event-Id. The IDs are
+// decimal integers, increasing from 1. History keeps the events in memory, and
+// FileStore on disk.
+type Store interface {
+	// Append records e as published to topic, and returns it with its ID
+	// set.
+	Append(topic string, e Event) (Event, error)
+
+	// LastID returns the ID of the last event appended, or "" if there is
+	// none.
+	LastID() string
+
+	// Since returns the retained events published to any of topics after the
+	// one with ID lastID, oldest first.
+	Since(lastID string, topics ...string) ([]Event, error)
+}
+
+// A HubOption configures a Hub.
+type HubOption func(*Hub)
+
+// WithStore records the events published on the hub in s, which assigns
+// their IDs, so that reconnecting clients can resume where they left off.
+func WithStore(s Store) HubOption {
+	return func(h *Hub) {
+		h.store = s
+	}
+}
+
+// WithMaxReplay limits the events replayed to a resuming client to those
+// among the last n published; older ones are skipped. The default is 1000; a
+// value of zero or less removes the limit.
+func WithMaxReplay(n int) HubOption {
+	return func(h *Hub) {
+		h.maxReplay = n
+	}
+}
+
+// A Subscription receives the events published to a set of topics on a Hub.
+type Subscription struct {
+	hub    *Hub
+	topics []string
+	events chan Event
+	err    error // under hub.mu
+}
+
+// NewHub returns a new hub with no subscribers.
+func NewHub(opts ...HubOption) *Hub {
+	h := &Hub{
+		topics:    make(map[string]map[*Subscription]struct{}),
+		maxReplay: defaultMaxReplay,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Publish sends e to every subscriber of topic, recording it in the hub's
+// store first, if it has one; if that fails, the error is returned and the
+// event is not sent. It never blocks: a subscriber whose buffer is full is
+// dropped, with ErrSlowSubscriber.
+func (h *Hub) Publish(topic string, e Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.store != nil {
+		var err error
+
+		if e, err = h.store.Append(topic, e); err != nil {
+			return err
+		}
+	}
+
+	for s := range h.topics[topic] {
+		select {
+		case s.events <- e:
+		default:
+			h.unsubscribe(s, ErrSlowSubscriber)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a subscription to the given topics. If the hub has been
+// closed, the subscription is closed too.
+func (h *Hub) Subscribe(topics ...string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.subscribe(topics)
+}
+
+// Resume returns a subscription to the given topics, along with the events
+// published to them after the one with ID lastID that are still in the hub's
+// store, up to its replay limit. Every later event is delivered by the
+// subscription, so none are missed or repeated. The store is read without
+// holding up Publish.
+func (h *Hub) Resume(lastID string, topics ...string) (*Subscription, []Event, error) {
+	h.mu.Lock()
+	s := h.subscribe(topics)
+
+	// events after mark are delivered by the subscription
+	var mark string
+	if h.store != nil {
+		mark = h.store.LastID()
+	}
+
+	h.mu.Unlock()
+
+	from, err := strconv.ParseUint(lastID, 10, 64)
+	to, _ := strconv.ParseUint(mark, 10, 64)
+
+	if err != nil || from >= to {
+		return s, nil, nil
+	}
+
+	if h.maxReplay > 0 && to-from > uint64(h.maxReplay) {
+		from = to - uint64(h.maxReplay)
+	}
+
+	missed, err := h.store.Since(strconv.FormatUint(from, 10), topics...)
+
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+
+	// drop the events published since the mark, which are already queued
+	// on the subscription
+	for i, e := range missed {
+		if id, _ := strconv.ParseUint(e.ID, 10, 64); id > to {
+			missed = missed[:i]
+			break
+		}
+	}
+
+	return s, missed, nil
+}
+
+// subscribe must be called with h.mu held.
+func (h *Hub) subscribe(topics []string) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		topics: topics,
+		events: make(chan Event, subscriptionBuffer),
+	}
+
+	if h.closed {
+		s.err = ErrClosed
+		close(s.events)
+		return s
+	}
+
+	for _, topic := range topics {
+		subs := h.topics[topic]
+
+		if subs == nil {
+			subs = make(map[*Subscription]struct{})
+			h.topics[topic] = subs
+		}
+
+		subs[s] = struct{}{}
+	}
+
+	return s
+}
+
+// unsubscribe removes s from the hub and closes its channel, recording err.
+// It must be called with h.mu held.
+func (h *Hub) unsubscribe(s *Subscription, err error) {
+	if s.err != nil {
+		return
+	}
+
+	for _, topic := range s.topics {
+		delete(h.topics[topic], s)
+
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+
+	s.err = err
+	close(s.events)
+}
+
+// Close closes every subscription, and any subscribed later.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+
+	for _, subs := range h.topics {
+		for s := range subs {
+			h.unsubscribe(s, ErrClosed)
+		}
+	}
+}
+
+// Events returns the channel delivering the subscription's events, in the
+// order they were published. It is closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns why the subscription ended: ErrClosed if it or the hub was
+// closed, or ErrSlowSubscriber if it was dropped. It returns nil while the
+// subscription is active.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.unsubscribe(s, ErrClosed)
+}
+
+// Handler returns a handler which streams events from the hub to each client,
+// subscribing it to the topics returned by topics for its request. A client
+// reconnecting with a Last-Event-Id is first sent the events it missed, from
+// the hub's store. If the client can't keep up and is dropped, its
+// connection is aborted so that it reconnects.
+func (h *Hub) Handler(topics func(r *http.Request) []string) StreamHandler {
+	return func(ctx context.Context, r *http.Request, enc *Encoder) error {
+		s, missed, err := h.Resume(r.Header.Get("Last-Event-Id"), topics(r)...)
+
+		if err != nil {
+			return err
+		}
+
+		defer s.Close()
+
+		if len(missed) > 0 {
+			batch := enc.Batch()
+
+			for _, e := range missed {
+				if err := batch.Encode(e); err != nil {
+					return err
+				}
+			}
+
+			if err := batch.Flush(); err != nil {
+				return err
+			}
+		}
+
+		for {
+			select {
+			case e, ok := <-s.Events():
+				if !ok {
+					if err := s.Err(); err != ErrClosed {
+						return err
+					}
+					return nil
+				}
+
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
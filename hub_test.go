@@ -0,0 +1,257 @@
+package eventsource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, s *Subscription) Event {
+	select {
+	case e := <-s.Events():
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	return Event{}
+}
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+	a, b := hub.Subscribe("a"), hub.Subscribe("a", "b")
+
+	hub.Publish("a", Event{Data: []byte("1")})
+	hub.Publish("b", Event{Data: []byte("2")})
+	hub.Publish("c", Event{Data: []byte("3")})
+
+	if e := receive(t, a); string(e.Data) != "1" {
+		t.Errorf("expected data = 1, got %q", e.Data)
+	}
+
+	for _, exp := range []string{"1", "2"} {
+		if e := receive(t, b); string(e.Data) != exp {
+			t.Errorf("expected data = %s, got %q", exp, e.Data)
+		}
+	}
+
+	a.Close()
+	hub.Publish("a", Event{Data: []byte("4")})
+
+	if _, ok := <-a.Events(); ok {
+		t.Error("expected closed subscription to receive nothing")
+	}
+
+	if a.Err() != ErrClosed {
+		t.Errorf("expected err = %v, got %v", ErrClosed, a.Err())
+	}
+
+	if e := receive(t, b); string(e.Data) != "4" {
+		t.Errorf("expected data = 4, got %q", e.Data)
+	}
+
+	hub.Close()
+
+	if _, ok := <-b.Events(); ok || b.Err() != ErrClosed {
+		t.Error("expected hub close to end subscriptions")
+	}
+
+	if _, ok := <-hub.Subscribe("a").Events(); ok {
+		t.Error("expected subscription to closed hub to be closed")
+	}
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	s := hub.Subscribe("a")
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.Publish("a", Event{})
+	}
+
+	for range s.Events() {
+	}
+
+	if s.Err() != ErrSlowSubscriber {
+		t.Errorf("expected err = %v, got %v", ErrSlowSubscriber, s.Err())
+	}
+}
+
+func TestHubHandler(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(hub.Handler(func(r *http.Request) []string {
+		return strings.Split(r.URL.Query().Get("topics"), ",")
+	}))
+	defer server.Close()
+	defer hub.Close()
+
+	es := New(request(server.URL+"?topics=a,b"), -1)
+	defer es.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := es.Events(ctx)
+
+	// wait for the connection to subscribe
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		hub.mu.Lock()
+		n := len(hub.topics["b"])
+		hub.mu.Unlock()
+
+		if n > 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for subscription")
+		}
+	}
+
+	hub.Publish("c", Event{Data: []byte("ignored")})
+	hub.Publish("b", Event{Type: "b", Data: []byte("hello")})
+
+	select {
+	case e := <-events:
+		if e.Type != "b" || string(e.Data) != "hello" {
+			t.Errorf("unexpected event %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(WithStore(NewHistory(0, 0)))
+	defer hub.Close()
+
+	for _, topic := range []string{"a", "b", "a"} {
+		hub.Publish(topic, Event{})
+	}
+
+	s, missed, err := hub.Resume("1", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.Publish("a", Event{})
+
+	if ids := eventIDs(missed); len(ids) != 1 || ids[0] != "3" {
+		t.Errorf("expected missed event 3, got %v", ids)
+	}
+
+	if e := receive(t, s); e.ID != "4" {
+		t.Errorf("expected live event 4, got %q", e.ID)
+	}
+}
+
+func TestHubHandlerResume(t *testing.T) {
+	hub := NewHub(WithStore(NewHistory(0, 0)))
+	defer hub.Close()
+
+	for _, data := range []string{"1", "2", "3"} {
+		hub.Publish("a", Event{Data: []byte(data)})
+	}
+
+	server := httptest.NewServer(hub.Handler(func(r *http.Request) []string {
+		return []string{"a"}
+	}))
+	defer server.Close()
+
+	es := New(request(server.URL), -1, WithRequestFunc(func(req *http.Request, lastEventID string, attempt int) (*http.Request, error) {
+		req.Header.Set("Last-Event-Id", "1")
+		return req, nil
+	}))
+	defer es.Close()
+
+	for _, exp := range []string{"2", "3"} {
+		e, err := es.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.ID != exp || string(e.Data) != exp {
+			t.Errorf("expected event %s, got %#v", exp, e)
+		}
+	}
+}
+
+// blockingStore is a Store whose Since waits to be released.
+type blockingStore struct {
+	*History
+	since, release chan struct{}
+}
+
+func (s blockingStore) Since(lastID string, topics ...string) ([]Event, error) {
+	close(s.since)
+	<-s.release
+	return s.History.Since(lastID, topics...)
+}
+
+func TestHubResumeOutsideLock(t *testing.T) {
+	store := blockingStore{NewHistory(0, 0), make(chan struct{}), make(chan struct{})}
+	hub := NewHub(WithStore(store))
+	defer hub.Close()
+
+	hub.Publish("a", Event{})
+	hub.Publish("a", Event{})
+
+	type result struct {
+		s      *Subscription
+		missed []Event
+	}
+
+	done := make(chan result)
+	go func() {
+		s, missed, _ := hub.Resume("0", "a")
+		done <- result{s, missed}
+	}()
+
+	<-store.since
+
+	// publishing isn't held up by a resume reading the store
+	published := make(chan struct{})
+	go func() {
+		hub.Publish("a", Event{})
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by resume")
+	}
+
+	close(store.release)
+	r := <-done
+
+	// the event published during the resume is delivered live, not replayed
+	if ids := eventIDs(r.missed); len(ids) != 2 || ids[1] != "2" {
+		t.Errorf("expected missed events 1 and 2, got %v", ids)
+	}
+
+	if e := receive(t, r.s); e.ID != "3" {
+		t.Errorf("expected live event 3, got %q", e.ID)
+	}
+}
+
+func TestHubMaxReplay(t *testing.T) {
+	hub := NewHub(WithStore(NewHistory(0, 0)), WithMaxReplay(2))
+	defer hub.Close()
+
+	for _, topic := range []string{"a", "a", "a", "b", "a"} {
+		hub.Publish(topic, Event{})
+	}
+
+	_, missed, err := hub.Resume("1", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := eventIDs(missed); len(ids) != 1 || ids[0] != "5" {
+		t.Errorf("expected only event 5 from the last 2, got %v", ids)
+	}
+}
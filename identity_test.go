@@ -31,6 +31,10 @@ func randomEvents() []Event {
 			event.Data = []byte(strconv.FormatInt(int64(i), 10))
 		}
 
+		if i%7 == 0 {
+			event.Extra = []Field{{"", []byte("comment")}, {"custom", []byte("value")}}
+		}
+
 		events[i] = event
 	}
 
@@ -40,6 +44,7 @@ func randomEvents() []Event {
 func TestEncodeDecodeIdentity(t *testing.T) {
 	r, w := io.Pipe()
 	d, e := NewDecoder(r), NewEncoder(w)
+	d.KeepExtraFields()
 
 	in := randomEvents()
 
@@ -0,0 +1,141 @@
+package eventsource
+
+import (
+	"net/http"
+	"time"
+)
+
+// An Option configures an EventSource. Hooks registered with OnClose may be
+// called from any goroutine; all others are called from the goroutine calling
+// Read().
+type Option func(*EventSource)
+
+// WithClient makes the EventSource issue every request, including
+// reconnects, with c instead of http.DefaultClient. A nil c means
+// http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(es *EventSource) {
+		if c == nil {
+			c = http.DefaultClient
+		}
+
+		es.client = c
+	}
+}
+
+// WithTransport makes the EventSource issue requests through rt. It is
+// shorthand for WithClient with a client using rt as its Transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return WithClient(&http.Client{Transport: rt})
+}
+
+// WithReconnectPolicy makes the EventSource consult p before reconnecting.
+// The default is DefaultReconnectPolicy.
+func WithReconnectPolicy(p ReconnectPolicy) Option {
+	return func(es *EventSource) {
+		es.policy = p
+	}
+}
+
+// OnOpen registers f to be called each time a connection is established.
+func OnOpen(f func()) Option {
+	return func(es *EventSource) {
+		es.onOpen = f
+	}
+}
+
+// OnError registers f to be called each time a connection fails or is lost
+// and will be retried, with the failure and the delay before the next
+// attempt.
+func OnError(f func(err error, delay time.Duration)) Option {
+	return func(es *EventSource) {
+		es.onError = f
+	}
+}
+
+// OnReconnect registers f to be called before each reconnect attempt, once
+// the delay has elapsed.
+func OnReconnect(f func(attempt int)) Option {
+	return func(es *EventSource) {
+		es.onReconnect = f
+	}
+}
+
+// OnClose registers f to be called once when the EventSource is closed, with
+// the error further calls to Read() will return.
+func OnClose(f func(err error)) Option {
+	return func(es *EventSource) {
+		es.onClose = f
+	}
+}
+
+// WithMaxRetryAfter caps the delay a server can request with a Retry-After
+// header on a 429 or 5xx response, which otherwise overrides the delay chosen
+// by the reconnect policy.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(es *EventSource) {
+		es.maxRetryAfter = d
+	}
+}
+
+// WithMaxRedirects limits the number of redirects followed for a single
+// connection attempt; exceeding it closes the EventSource with
+// ErrTooManyRedirects. The default is 10.
+func WithMaxRedirects(n int) Option {
+	return func(es *EventSource) {
+		es.maxRedirects = n
+	}
+}
+
+// OnRedirect registers f to be called before following each redirect, with
+// the upcoming request and the requests made so far, oldest first. Permanent
+// (301 and 308) redirects from the original URL are remembered, and later
+// reconnects go straight to the new URL.
+func OnRedirect(f func(req *http.Request, via []*http.Request)) Option {
+	return func(es *EventSource) {
+		es.onRedirect = f
+	}
+}
+
+// WithRequestFunc makes the EventSource call f to prepare each connection
+// attempt, for example to refresh credentials before reconnecting.
+func WithRequestFunc(f RequestFunc) Option {
+	return func(es *EventSource) {
+		es.requestFunc = f
+	}
+}
+
+// WithMaxEventSize limits the size of lines and events the EventSource will
+// decode, as with NewDecoderSize, and uses policy to handle events which are
+// too large.
+func WithMaxEventSize(maxLine, maxEvent int, policy OversizePolicy) Option {
+	return func(es *EventSource) {
+		es.maxLine = maxLine
+		es.maxEvent = maxEvent
+		es.oversize = policy
+	}
+}
+
+// OnInvalidEvent registers f to be called each time an event is dropped
+// because it could not be decoded, with a *DecodeError or ErrEventTooLarge.
+func OnInvalidEvent(f func(err error)) Option {
+	return func(es *EventSource) {
+		es.onInvalidEvent = f
+	}
+}
+
+// WithExtraFields makes the EventSource record comments and unrecognised
+// fields in the Extra field of the events it returns.
+func WithExtraFields() Option {
+	return func(es *EventSource) {
+		es.keepExtra = true
+	}
+}
+
+// OnComment registers f to be called with the text of each comment received,
+// such as keepalives sent by the server.
+func OnComment(f func(text string)) Option {
+	return func(es *EventSource) {
+		es.onComment = f
+	}
+}
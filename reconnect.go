@@ -0,0 +1,90 @@
+package eventsource
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A ReconnectPolicy decides how long an EventSource waits before trying to
+// reconnect, and when it should give up.
+type ReconnectPolicy interface {
+	// Delay is called before each reconnect attempt, numbered from 1 and
+	// reset once an event has been received. err is the failure which
+	// prompted the reconnect, and retry is the current reconnection time:
+	// initially the duration given to New, and updated by the server through
+	// the retry field. If ok is false, the EventSource gives up and returns
+	// err from Read.
+	Delay(attempt int, err error, retry time.Duration) (delay time.Duration, ok bool)
+}
+
+// ReconnectPolicyFunc is an adapter to allow the use of ordinary functions as
+// reconnect policies.
+type ReconnectPolicyFunc func(attempt int, err error, retry time.Duration) (time.Duration, bool)
+
+// Delay returns f(attempt, err, retry).
+func (f ReconnectPolicyFunc) Delay(attempt int, err error, retry time.Duration) (time.Duration, bool) {
+	return f(attempt, err, retry)
+}
+
+// DefaultReconnectPolicy waits the current reconnection time before every
+// attempt, and never gives up.
+var DefaultReconnectPolicy ReconnectPolicy = ReconnectPolicyFunc(
+	func(attempt int, err error, retry time.Duration) (time.Duration, bool) {
+		return retry, true
+	},
+)
+
+// ConstantBackoff returns a policy which always waits d, ignoring the
+// reconnection time requested by the server.
+func ConstantBackoff(d time.Duration) ReconnectPolicy {
+	return ReconnectPolicyFunc(func(int, error, time.Duration) (time.Duration, bool) {
+		return d, true
+	})
+}
+
+// ExponentialBackoff returns a policy which doubles its delay with each
+// attempt, starting at base and never exceeding max, and waits a random
+// duration between zero and that delay ("full jitter"), so that many clients
+// disconnected at once do not reconnect in lockstep. If base is not positive,
+// the current reconnection time is used instead; if max is not positive, the
+// delay is uncapped.
+func ExponentialBackoff(base, max time.Duration) ReconnectPolicy {
+	return ReconnectPolicyFunc(func(attempt int, err error, retry time.Duration) (time.Duration, bool) {
+		d := base
+		if d <= 0 {
+			d = retry
+		}
+
+		if d <= 0 {
+			return 0, true
+		}
+
+		for i := 1; i < attempt && d < math.MaxInt64/2; i++ {
+			d *= 2
+		}
+
+		if max > 0 && d > max {
+			d = max
+		}
+
+		// leave room for the +1 below
+		if d == math.MaxInt64 {
+			d--
+		}
+
+		return time.Duration(rand.Int63n(int64(d) + 1)), true
+	})
+}
+
+// MaxAttempts returns a policy which defers to p, but gives up after n
+// consecutive failed attempts.
+func MaxAttempts(p ReconnectPolicy, n int) ReconnectPolicy {
+	return ReconnectPolicyFunc(func(attempt int, err error, retry time.Duration) (time.Duration, bool) {
+		if attempt > n {
+			return 0, false
+		}
+
+		return p.Delay(attempt, err, retry)
+	})
+}
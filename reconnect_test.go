@@ -0,0 +1,63 @@
+package eventsource
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	p := ConstantBackoff(time.Second)
+
+	for attempt := 1; attempt < 5; attempt++ {
+		d, ok := p.Delay(attempt, nil, time.Minute)
+
+		if !ok || d != time.Second {
+			t.Errorf("%d. expected delay = %s, got %s (ok = %t)", attempt, time.Second, d, ok)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	table := []struct {
+		base, max time.Duration
+		attempt   int
+		retry     time.Duration
+		limit     time.Duration
+	}{
+		{time.Second, time.Minute, 1, 0, time.Second},
+		{time.Second, time.Minute, 3, 0, 4 * time.Second},
+		{time.Second, time.Minute, 10, 0, time.Minute},
+		{time.Second, time.Minute, 1000, 0, time.Minute},
+		{0, time.Minute, 2, time.Second, 2 * time.Second},
+		{time.Second, 0, 1000, 0, 1<<63 - 1},
+		{1<<63 - 1, 0, 1, 0, 1<<63 - 1},
+	}
+
+	for i, tt := range table {
+		p := ExponentialBackoff(tt.base, tt.max)
+
+		for n := 0; n < 100; n++ {
+			d, ok := p.Delay(tt.attempt, nil, tt.retry)
+
+			if !ok {
+				t.Fatalf("%d. policy gave up", i)
+			}
+
+			if d < 0 || d > tt.limit {
+				t.Fatalf("%d. expected delay in [0, %s], got %s", i, tt.limit, d)
+			}
+		}
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	p := MaxAttempts(DefaultReconnectPolicy, 2)
+	cause := errors.New("cause")
+
+	for attempt, exp := range map[int]bool{1: true, 2: true, 3: false} {
+		if _, ok := p.Delay(attempt, cause, 0); ok != exp {
+			t.Errorf("attempt %d: expected ok = %t, got %t", attempt, exp, ok)
+		}
+	}
+}